@@ -0,0 +1,233 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ChangePasswordHandler replaces the current user's password and logs out their other sessions
+func (S *Server) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	_, sessionID, _ := S.CheckSession(r)
+
+	var body struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if err := S.CheckCurrentPassword(r, currentUserID, body.CurrentPassword); err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if !tools.IsValidPassword(body.NewPassword) {
+		tools.SendJSONError(w, "password must be at least 8 characters with an uppercase letter, a lowercase letter and a number", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		tools.SendJSONError(w, "failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	queries := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE users SET password = ? WHERE id = ?`, []interface{}{hashedPassword, currentUserID}},
+		{`DELETE FROM sessions WHERE user_id = ? AND session_id != ?`, []interface{}{currentUserID, sessionID}},
+		// a reset link mailed before the change must not undo it
+		{`DELETE FROM email_tokens WHERE user_id = ? AND purpose = ? AND used_at IS NULL`, []interface{}{currentUserID, TokenResetPassword}},
+	}
+	for _, q := range queries {
+		if _, err := tx.Exec(q.query, q.args...); err != nil {
+			fmt.Println("Change Password Error : ", err)
+			tools.SendJSONError(w, "failed to change password", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tools.SendJSONError(w, "failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+	S.DisconnectRevokedClients(currentUserID)
+
+	var email string
+	if err := S.db.QueryRow(`SELECT email FROM users WHERE id = ?`, currentUserID).Scan(&email); err == nil {
+		S.SendMail(email, "Your password was changed",
+			"The password of your account was just changed and your other sessions were logged out.\n\nIf it was not you, reset your password at "+AppURL+"/forgot-password")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "password changed"})
+}
+
+// ChangeEmailHandler mails a confirmation link to the new address. The account keeps its
+// current address until the link is followed.
+func (S *Server) ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewEmail        string `json:"newEmail"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if err := S.CheckCurrentPassword(r, currentUserID, body.CurrentPassword); err != nil {
+		SendActionError(w, err)
+		return
+	}
+	newEmail := refactorUserData(User{Email: body.NewEmail}).Email
+	if !tools.IsValidEmail(newEmail) {
+		tools.SendJSONError(w, "invalid email", http.StatusBadRequest)
+		return
+	}
+	newEmail = html.EscapeString(newEmail)
+	if err := S.CheckEmailAvailable(currentUserID, newEmail); err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if S.EmailTokenCoolingDown(currentUserID, TokenChangeEmail) {
+		tools.SendJSONError(w, "please wait before requesting another email", http.StatusTooManyRequests)
+		return
+	}
+
+	var oldEmail string
+	if err := S.db.QueryRow(`SELECT email FROM users WHERE id = ?`, currentUserID).Scan(&oldEmail); err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := S.IssueEmailToken(currentUserID, TokenChangeEmail, newEmail, EmailChangeTTL)
+	if err != nil {
+		fmt.Println("Change Email Error : ", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	S.SendMail(newEmail, "Confirm your new email address", fmt.Sprintf(
+		"Confirm this address for your account within %s:\n%s/confirm-email?token=%s",
+		EmailChangeTTL, AppURL, token))
+	S.SendMail(oldEmail, "Your email address is being changed", fmt.Sprintf(
+		"Someone asked to move your account to %s. It will only change once the link sent there is followed.\n\nIf it was not you, change your password at %s",
+		newEmail, AppURL))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "confirmation email sent"})
+}
+
+// ConfirmEmailChangeHandler switches an account to the address of a change_email token.
+// The new address is verified by following the link.
+func (S *Server) ConfirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	banned, _ := S.ActionMiddleware(r, http.MethodPost, false, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		tools.SendJSONError(w, "failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := ConsumeEmailToken(tx, body.Token, TokenChangeEmail)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	var newEmail string
+	if err := tx.QueryRow(`SELECT new_email FROM email_tokens WHERE token_hash = ?`, hashToken(body.Token)).Scan(&newEmail); err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// the address may have been taken since the link was sent
+	if err := S.CheckEmailAvailable(userID, newEmail); err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if _, err := tx.Exec(`UPDATE users SET email = ?, email_verified = 1 WHERE id = ?`, newEmail, userID); err != nil {
+		fmt.Println("Confirm Email Change Error : ", err)
+		tools.SendJSONError(w, "failed to change email", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tools.SendJSONError(w, "failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "email changed", "email": newEmail})
+}
+
+// CheckCurrentPassword returns a 403 ActionError unless password is userID's password.
+// Wrong passwords count against the account and address like failed logins, so a stolen
+// session cannot be used to guess the password; during a lockout it returns a LoginLockedError.
+func (S *Server) CheckCurrentPassword(r *http.Request, userID int, password string) error {
+	accountKey, ipKey := loginThrottleKeys(r, userID, "")
+	if err := S.CheckLoginLocked(accountKey, ipKey); err != nil {
+		return err
+	}
+	var hashedPassword string
+	if err := S.db.QueryRow(`SELECT password FROM users WHERE id = ?`, userID).Scan(&hashedPassword); err != nil {
+		return err
+	}
+	if password == "" || tools.CheckPassword(hashedPassword, password) != nil {
+		S.LoginFailed(r, userID, accountKey, ipKey, SecurityPasswordCheckFailed)
+		return NewActionError(http.StatusForbidden, "current password is incorrect")
+	}
+	S.ClearLoginFailures(accountKey)
+	return nil
+}
+
+// CheckEmailAvailable returns a 409 ActionError when another account uses email,
+// and a 400 one when userID already does
+func (S *Server) CheckEmailAvailable(userID int, email string) error {
+	var otherID int
+	err := S.db.QueryRow(`SELECT id FROM users WHERE email = ?`, email).Scan(&otherID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		return err
+	case otherID == userID:
+		return NewActionError(http.StatusBadRequest, "this is already your email")
+	default:
+		return NewActionError(http.StatusConflict, "email already in use")
+	}
+}
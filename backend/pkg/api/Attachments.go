@@ -0,0 +1,91 @@
+package backend
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RecordAttachment remembers who uploaded a message file, so only they can send it
+func (S *Server) RecordAttachment(uploaderID int, path, mimeType string, size int64) error {
+	_, err := S.db.Exec(`
+		INSERT INTO message_attachments (path, uploader_id, mime_type, size) VALUES (?, ?, ?, ?)
+	`, path, uploaderID, mimeType, size)
+	return err
+}
+
+// CheckMediaContent validates the content of an image or gif message. Images must be a file
+// senderID uploaded and has not sent yet. Gifs can also be an external link from the gif picker.
+func (S *Server) CheckMediaContent(senderID int, msgType, content string) error {
+	if msgType != "image" && msgType != "gif" {
+		return nil
+	}
+
+	if msgType == "gif" && !strings.HasPrefix(content, "/uploads/") {
+		u, err := url.Parse(content)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return NewActionError(http.StatusBadRequest, "Invalid gif link")
+		}
+		return nil
+	}
+
+	var uploaderID int
+	var mimeType string
+	var linked bool
+	err := S.db.QueryRow(`
+		SELECT uploader_id, mime_type, message_id IS NOT NULL OR group_message_id IS NOT NULL
+		FROM message_attachments WHERE path = ?
+	`, content).Scan(&uploaderID, &mimeType, &linked)
+	if err == sql.ErrNoRows || (err == nil && (uploaderID != senderID || linked)) {
+		return NewActionError(http.StatusBadRequest, "Upload the file with type message before sending it")
+	}
+	if err != nil {
+		return err
+	}
+	if msgType == "gif" && mimeType != "image/gif" {
+		return NewActionError(http.StatusBadRequest, "Attachment is not a gif")
+	}
+	return nil
+}
+
+// LinkAttachment ties an uploaded file to the direct message (column "message_id")
+// or group message (column "group_message_id") it was sent in
+func (S *Server) LinkAttachment(column string, messageID int, path string) error {
+	if column != "message_id" && column != "group_message_id" {
+		return fmt.Errorf("unknown attachment column %q", column)
+	}
+	_, err := S.db.Exec(`
+		UPDATE message_attachments SET `+column+` = ?
+		WHERE path = ? AND message_id IS NULL AND group_message_id IS NULL
+	`, messageID, path)
+	return err
+}
+
+// RemoveAttachments deletes the files sent in the messages matched by where,
+// a condition on message_attachments such as "message_id = ?"
+func (S *Server) RemoveAttachments(where string, args ...interface{}) {
+	rows, err := S.db.Query(`SELECT path FROM message_attachments WHERE `+where, args...)
+	if err != nil {
+		fmt.Println("Remove Attachments Error : ", err)
+		return
+	}
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	rows.Close()
+
+	for _, path := range paths {
+		if err := RemoveUploadedFile(path); err != nil {
+			fmt.Println("Remove Attachment File Error : ", err)
+		}
+	}
+	if _, err := S.db.Exec(`DELETE FROM message_attachments WHERE `+where, args...); err != nil {
+		fmt.Println("Remove Attachments Error : ", err)
+	}
+}
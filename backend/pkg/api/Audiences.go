@@ -0,0 +1,434 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxAudienceListName is the longest name an audience list can have
+const MaxAudienceListName = 50
+
+// audienceMemberSQL holds when user ? is in one of the lists post p is shared with and still
+// follows its author. Membership is resolved when the post is read, so a member added later
+// sees earlier posts, and one who unfollows loses access.
+const audienceMemberSQL = `EXISTS (
+	SELECT 1 FROM post_audiences pa
+	JOIN audience_list_members am ON am.list_id = pa.list_id
+	JOIN follows f ON f.follower_id = am.user_id AND f.following_id = p.user_id
+	WHERE pa.post_id = p.id AND am.user_id = ?
+)`
+
+// GetAudienceListsHandler returns the current user's audience lists with their members
+func (S *Server) GetAudienceListsHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := S.db.Query(`SELECT id FROM audience_lists WHERE owner_id = ? ORDER BY name`, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	lists := []AudienceList{}
+	for _, id := range ids {
+		list, err := S.GetAudienceList(id, currentUserID)
+		if err != nil {
+			SendActionError(w, err)
+			return
+		}
+		lists = append(lists, list)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lists)
+}
+
+// CreateAudienceListHandler creates a named list, optionally with its first members
+func (S *Server) CreateAudienceListHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Name    string `json:"name"`
+		Members []int  `json:"members"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	name, err := S.checkAudienceListName(currentUserID, 0, body.Name)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if err := S.CheckFollowers(currentUserID, body.Members); err != nil {
+		SendActionError(w, err)
+		return
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		tools.SendJSONError(w, "failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO audience_lists (owner_id, name) VALUES (?, ?)`, currentUserID, name)
+	if err != nil {
+		fmt.Println("Create Audience List Error : ", err)
+		tools.SendJSONError(w, "failed to create list", http.StatusInternalServerError)
+		return
+	}
+	listID, _ := res.LastInsertId()
+	for _, userID := range body.Members {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO audience_list_members (list_id, user_id) VALUES (?, ?)`, listID, userID); err != nil {
+			fmt.Println("Create Audience List Error : ", err)
+			tools.SendJSONError(w, "failed to create list", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tools.SendJSONError(w, "failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	list, err := S.GetAudienceList(int(listID), currentUserID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(list)
+}
+
+// RenameAudienceListHandler renames one of the current user's lists
+func (S *Server) RenameAudienceListHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPut, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if !S.checkAudienceListOwner(w, r, body.ID, currentUserID) {
+		return
+	}
+	name, err := S.checkAudienceListName(currentUserID, body.ID, body.Name)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if _, err := S.db.Exec(`UPDATE audience_lists SET name = ? WHERE id = ?`, name, body.ID); err != nil {
+		tools.SendJSONError(w, "failed to rename list", http.StatusInternalServerError)
+		return
+	}
+
+	S.sendAudienceList(w, body.ID, currentUserID)
+}
+
+// DeleteAudienceListHandler deletes a list. Posts shared with it are no longer shown to its members.
+func (S *Server) DeleteAudienceListHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodDelete, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	checkListID, listID := tools.IsNumeric(r.URL.Path[len("/api/audiences/delete/"):])
+	if !checkListID {
+		tools.SendJSONError(w, "invalid list ID", http.StatusBadRequest)
+		return
+	}
+	if !S.checkAudienceListOwner(w, r, listID, currentUserID) {
+		return
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		tools.SendJSONError(w, "failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		`DELETE FROM post_audiences WHERE list_id = ?`,
+		`DELETE FROM audience_list_members WHERE list_id = ?`,
+		`DELETE FROM audience_lists WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(query, listID); err != nil {
+			tools.SendJSONError(w, "failed to delete list", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tools.SendJSONError(w, "failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "list deleted"})
+}
+
+// AddAudienceMembersHandler adds followers to a list. They can read the posts already shared with it.
+func (S *Server) AddAudienceMembersHandler(w http.ResponseWriter, r *http.Request) {
+	S.updateAudienceMembers(w, r, `INSERT OR IGNORE INTO audience_list_members (list_id, user_id) VALUES (?, ?)`, true)
+}
+
+// RemoveAudienceMembersHandler takes users out of a list
+func (S *Server) RemoveAudienceMembersHandler(w http.ResponseWriter, r *http.Request) {
+	S.updateAudienceMembers(w, r, `DELETE FROM audience_list_members WHERE list_id = ? AND user_id = ?`, false)
+}
+
+// updateAudienceMembers runs query with the list id and each user id of the request body,
+// checking first that they follow the current user when mustFollow is set
+func (S *Server) updateAudienceMembers(w http.ResponseWriter, r *http.Request, query string, mustFollow bool) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		ListID  int   `json:"listId"`
+		UserIDs []int `json:"userIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if len(body.UserIDs) == 0 {
+		tools.SendJSONError(w, "userIds is required", http.StatusBadRequest)
+		return
+	}
+
+	if !S.checkAudienceListOwner(w, r, body.ListID, currentUserID) {
+		return
+	}
+	if mustFollow {
+		if err := S.CheckFollowers(currentUserID, body.UserIDs); err != nil {
+			SendActionError(w, err)
+			return
+		}
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		tools.SendJSONError(w, "failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	for _, userID := range body.UserIDs {
+		if _, err := tx.Exec(query, body.ListID, userID); err != nil {
+			fmt.Println("Update Audience Members Error : ", err)
+			tools.SendJSONError(w, "failed to update list", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tools.SendJSONError(w, "failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	S.sendAudienceList(w, body.ListID, currentUserID)
+}
+
+// checkAudienceListOwner writes the error and returns false unless listID belongs to currentUserID.
+// Naming someone else's list counts as a forged request.
+func (S *Server) checkAudienceListOwner(w http.ResponseWriter, r *http.Request, listID, currentUserID int) bool {
+	var ownerID int
+	err := S.db.QueryRow(`SELECT owner_id FROM audience_lists WHERE id = ?`, listID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "audience list not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if ownerID != currentUserID {
+		S.RecordStrike(r, currentUserID, "naming another user's audience list")
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// checkAudienceListName validates a list name and returns it as stored.
+// listID is the list being renamed, 0 for a new one.
+func (S *Server) checkAudienceListName(ownerID, listID int, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", NewActionError(http.StatusBadRequest, "name is required")
+	}
+	if utf8.RuneCountInString(name) > MaxAudienceListName {
+		return "", NewActionError(http.StatusBadRequest, fmt.Sprintf("name must be at most %d characters", MaxAudienceListName))
+	}
+	name = html.EscapeString(name)
+
+	var taken bool
+	if err := S.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM audience_lists WHERE owner_id = ? AND name = ? AND id != ?)
+	`, ownerID, name, listID).Scan(&taken); err != nil {
+		return "", err
+	}
+	if taken {
+		return "", NewActionError(http.StatusConflict, "you already have a list with this name")
+	}
+	return name, nil
+}
+
+func (S *Server) sendAudienceList(w http.ResponseWriter, listID, ownerID int) {
+	list, err := S.GetAudienceList(listID, ownerID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetAudienceList returns one of ownerID's lists with its members
+func (S *Server) GetAudienceList(listID, ownerID int) (AudienceList, error) {
+	list := AudienceList{Members: []SearchUser{}}
+	err := S.db.QueryRow(`
+		SELECT id, name, created_at FROM audience_lists WHERE id = ? AND owner_id = ?
+	`, listID, ownerID).Scan(&list.ID, &list.Name, &list.CreatedAt)
+	if err == sql.ErrNoRows {
+		return AudienceList{}, NewActionError(http.StatusNotFound, "audience list not found")
+	}
+	if err != nil {
+		return AudienceList{}, err
+	}
+
+	rows, err := S.db.Query(`
+		SELECT u.id, u.first_name || ' ' || u.last_name, COALESCE(u.nickname, ''), COALESCE(u.avatar, ''), u.url
+		FROM audience_list_members am
+		JOIN users u ON u.id = am.user_id
+		WHERE am.list_id = ?
+		ORDER BY am.added_at, u.id
+	`, listID)
+	if err != nil {
+		return AudienceList{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var member SearchUser
+		if err := rows.Scan(&member.ID, &member.Name, &member.Username, &member.Avatar, &member.Url); err != nil {
+			return AudienceList{}, err
+		}
+		list.Members = append(list.Members, member)
+	}
+	return list, rows.Err()
+}
+
+// CheckFollowers returns a 400 ActionError unless every id in userIDs follows ownerID
+func (S *Server) CheckFollowers(ownerID int, userIDs []int) error {
+	for _, userID := range userIDs {
+		isFollower, err := S.IsFollowing(userID, "", ownerID)
+		if err != nil {
+			return err
+		}
+		if !isFollower {
+			return NewActionError(http.StatusBadRequest, fmt.Sprintf("user %d does not follow you", userID))
+		}
+	}
+	return nil
+}
+
+// CheckPostAudience validates the audience of a private post: selected followers must follow
+// the author and lists must be theirs. It returns the followers as ids.
+func (S *Server) CheckPostAudience(authorID int, selectedFollowers []string, lists []int) ([]int, error) {
+	var followers []int
+	for _, follower := range selectedFollowers {
+		isNumeric, followerID := tools.IsNumeric(follower)
+		if !isNumeric {
+			return nil, NewActionError(http.StatusBadRequest, "selectedFollowers must be user ids")
+		}
+		followers = append(followers, followerID)
+	}
+	if err := S.CheckFollowers(authorID, followers); err != nil {
+		return nil, err
+	}
+
+	for _, listID := range lists {
+		var owned bool
+		if err := S.db.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM audience_lists WHERE id = ? AND owner_id = ?)
+		`, listID, authorID).Scan(&owned); err != nil {
+			return nil, err
+		}
+		if !owned {
+			return nil, NewActionError(http.StatusBadRequest, fmt.Sprintf("audience list %d not found", listID))
+		}
+	}
+	return followers, nil
+}
+
+// GetPostAudienceLists returns the ids of the lists a post is shared with
+func (S *Server) GetPostAudienceLists(postID int) ([]int, error) {
+	rows, err := S.db.Query(`SELECT list_id FROM post_audiences WHERE post_id = ? ORDER BY list_id`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var lists []int
+	for rows.Next() {
+		var listID int
+		if err := rows.Scan(&listID); err != nil {
+			return nil, err
+		}
+		lists = append(lists, listID)
+	}
+	return lists, rows.Err()
+}
+
+// SavePostAudience replaces who a post is shared with besides its privacy setting.
+// Both are left empty for posts that are not private.
+func SavePostAudience(db execer, postID int, followers, lists []int) error {
+	if _, err := db.Exec(`DELETE FROM posts_private WHERE post_id = ?`, postID); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM post_audiences WHERE post_id = ?`, postID); err != nil {
+		return err
+	}
+	for _, followerID := range followers {
+		if _, err := db.Exec(`INSERT INTO posts_private (post_id, user_id) VALUES (?, ?)`, postID, followerID); err != nil {
+			return err
+		}
+	}
+	for _, listID := range lists {
+		if _, err := db.Exec(`INSERT OR IGNORE INTO post_audiences (post_id, list_id) VALUES (?, ?)`, postID, listID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
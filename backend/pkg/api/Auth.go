@@ -49,28 +49,46 @@ func (S *Server) LoggedHandler(w http.ResponseWriter, r *http.Request) {
 		"loggedIn": true,
 	})
 }
-func (S *Server) MakeToken(Writer http.ResponseWriter, id int) error {
+
+// MakeToken opens a session for user id on the device making r and sets its cookie.
+// A remembered session gets a persistent cookie and its expiry slides forward while it is used;
+// otherwise the cookie ends with the browser session and the session after SessionTTL.
+func (S *Server) MakeToken(Writer http.ResponseWriter, r *http.Request, id int, remember bool) error {
 	sessionID := uuid.NewV4().String()
-	expirationTime := time.Now().Add(24 * time.Hour)
+	ttl := SessionTTL
+	if remember {
+		ttl = RememberSessionTTL
+	}
+	expirationTime := time.Now().Add(ttl).UTC()
 
-	_, err := S.db.Exec("INSERT INTO sessions (session_id, user_id, expires_at) VALUES (?, ?, ?)",
-		sessionID, id, expirationTime)
+	_, err := S.db.Exec(`
+		INSERT INTO sessions (session_id, user_id, expires_at, user_agent, ip, created_at, last_seen_at, remember)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?)`,
+		sessionID, id, expirationTime.Format("2006-01-02 15:04:05"), userAgent(r), clientIP(r), remember)
 	if err != nil {
 		fmt.Println("Error creating session:", err)
 		return err
 	}
 
-	http.SetCookie(Writer, &http.Cookie{
+	setSessionCookie(Writer, sessionID, expirationTime, remember)
+	return nil
+}
+
+func setSessionCookie(w http.ResponseWriter, sessionID string, expires time.Time, persistent bool) {
+	cookie := &http.Cookie{
 		Name:     "session_token",
 		Value:    sessionID,
-		Expires:  expirationTime,
 		HttpOnly: true,
 		Path:     "/",
 		SameSite: http.SameSiteLaxMode,
 		Secure:   false,
-	})
-	return nil
+	}
+	if persistent {
+		cookie.Expires = expires
+	}
+	http.SetCookie(w, cookie)
 }
+
 func (S *Server) CheckSession(r *http.Request) (int, string, error) {
 
 	cookie, err := r.Cookie("session_token")
@@ -78,38 +96,48 @@ func (S *Server) CheckSession(r *http.Request) (int, string, error) {
 		return 0, "", fmt.Errorf("no session cookie")
 	}
 	sessionID := cookie.Value
-	var userID int
-	err = S.db.QueryRow(`
-        SELECT user_id FROM sessions 
-        WHERE session_id = ? AND expires_at > CURRENT_TIMESTAMP
-    `, sessionID).Scan(&userID)
-
+	userID, err := S.SessionUserID(sessionID)
 	if err != nil {
-		return 0, "", fmt.Errorf("invalid or expired session")
-	}
-	// var banned bool
-	// err = S.db.QueryRow(`SELECT is_blocked FROM users WHERE id = ?`, userID).Scan(&banned)
-	// if err != nil {
-	// 	return 0, "", fmt.Errorf("failed to check user status")
-	// }
-	// if banned {
-	// 	S.db.Exec("DELETE FROM sessions WHERE session_id = ?", sessionID)
-	// 	return 0, "", fmt.Errorf("user is banned")
-	// }
+		return 0, "", err
+	}
+	banned, err := S.IsSuspended(userID)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to check user status")
+	}
+	if banned {
+		return 0, "", fmt.Errorf("user is banned")
+	}
 	return userID, sessionID, nil
 }
 
 func (S *Server) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, _, err := S.CheckSession(r)
+		_, sessionID, err := S.CheckSession(r)
 		if err != nil {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
+		S.TouchSession(w, sessionID)
 		next.ServeHTTP(w, r)
 	}
 }
 
+// SessionUserID returns the user of a session that has not expired yet
+func (S *Server) SessionUserID(sessionID string) (int, error) {
+	var userID int
+	err := S.db.QueryRow(`
+        SELECT user_id FROM sessions 
+        WHERE session_id = ? AND expires_at > CURRENT_TIMESTAMP
+    `, sessionID).Scan(&userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid or expired session")
+	}
+	return userID, nil
+}
+
+// ActionMiddleware reports whether a request must be refused, for the wrong method or, when
+// needToLogged, no valid session, and returns the session's user. banned marks a request the
+// caller found forged: it is refused and a strike is recorded, see RecordStrike.
 func (S *Server) ActionMiddleware(r *http.Request, Method string, needToLogged bool, banned bool) (bool, int) {
 	NeedToBaned := false
 	if r.Method != Method {
@@ -119,6 +147,10 @@ func (S *Server) ActionMiddleware(r *http.Request, Method string, needToLogged b
 	if err != nil && needToLogged {
 		NeedToBaned = true
 	}
+	if banned {
+		S.RecordStrike(r, UserId, "suspicious request")
+		NeedToBaned = true
+	}
 
 	return NeedToBaned, UserId
 }
@@ -0,0 +1,180 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// BlockUserHandler blocks another user: follows, follow requests and the direct chat between
+// the two are removed, and from then on neither can see or reach the other
+func (S *Server) BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		UserID int `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if body.UserID == currentUserID {
+		tools.SendJSONError(w, "cannot block yourself", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	if err := S.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)`, body.UserID).Scan(&exists); err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		tools.SendJSONError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	if err := S.BlockUser(currentUserID, body.UserID); err != nil {
+		fmt.Println("Block User Error : ", err)
+		tools.SendJSONError(w, "failed to block user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"userId": body.UserID, "blocked": true})
+}
+
+// UnblockUserHandler lifts a block set by the current user. Removed follows and chats are not restored.
+func (S *Server) UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		UserID int `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := S.db.Exec(`DELETE FROM blocks WHERE blocker_id = ? AND blocked_id = ?`, currentUserID, body.UserID); err != nil {
+		tools.SendJSONError(w, "failed to unblock user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"userId": body.UserID, "blocked": false})
+}
+
+// GetBlockedUsersHandler lists the users the current user has blocked, most recent first
+func (S *Server) GetBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := S.db.Query(`
+		SELECT u.id, u.first_name || ' ' || u.last_name, COALESCE(u.nickname, ''), COALESCE(u.avatar, ''), u.url, b.created_at
+		FROM blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = ?
+		ORDER BY b.created_at DESC, b.rowid DESC
+	`, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	blocked := []BlockedUser{}
+	for rows.Next() {
+		var user BlockedUser
+		if err := rows.Scan(&user.ID, &user.Name, &user.Username, &user.Avatar, &user.Url, &user.BlockedAt); err != nil {
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		blocked = append(blocked, user)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blocked)
+}
+
+// BlockUser records the block and removes what connects the two users:
+// follows, follow requests, private post audiences and their direct chat
+func (S *Server) BlockUser(blockerID, blockedID int) error {
+	tx, err := S.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`INSERT OR IGNORE INTO blocks (blocker_id, blocked_id) VALUES (?, ?)`,
+		`DELETE FROM follows WHERE (follower_id = ? AND following_id = ?) OR (follower_id = ?2 AND following_id = ?1)`,
+		`DELETE FROM follow_requests WHERE (sender_id = ? AND receiver_id = ?) OR (sender_id = ?2 AND receiver_id = ?1)`,
+		// a pending request can be accepted from its notification
+		`DELETE FROM notifications WHERE type = 'follow_request' AND ((user_id = ? AND actor_id = ?) OR (user_id = ?2 AND actor_id = ?1))`,
+		`DELETE FROM posts_private
+		WHERE (user_id = ?2 AND post_id IN (SELECT id FROM posts WHERE user_id = ?1))
+		   OR (user_id = ?1 AND post_id IN (SELECT id FROM posts WHERE user_id = ?2))`,
+		`DELETE FROM audience_list_members
+		WHERE (user_id = ?2 AND list_id IN (SELECT id FROM audience_lists WHERE owner_id = ?1))
+		   OR (user_id = ?1 AND list_id IN (SELECT id FROM audience_lists WHERE owner_id = ?2))`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, blockerID, blockedID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	var chatID int
+	err = S.db.QueryRow(`
+		SELECT id FROM chats WHERE is_group = 0 AND ((user1_id = ? AND user2_id = ?) OR (user1_id = ?2 AND user2_id = ?1))
+	`, blockerID, blockedID).Scan(&chatID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// the chat is deleted with its messages once both have left
+	if err := S.RemoveChatParticipant(chatID, blockerID); err != nil {
+		return err
+	}
+	return S.RemoveChatParticipant(chatID, blockedID)
+}
+
+// IsBlocked reports whether either user has blocked the other
+func (S *Server) IsBlocked(userID, otherUserID int) (bool, error) {
+	var blocked bool
+	err := S.db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM blocks
+			WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ?2 AND blocked_id = ?1)
+		)
+	`, userID, otherUserID).Scan(&blocked)
+	return blocked, err
+}
+
+// NotBlockedCondition returns the SQL condition under which the user in column and viewerID
+// have not blocked each other
+func NotBlockedCondition(column string, viewerID int) (string, []interface{}) {
+	return `NOT EXISTS (
+		SELECT 1 FROM blocks bl
+		WHERE (bl.blocker_id = ? AND bl.blocked_id = ` + column + `)
+		   OR (bl.blocker_id = ` + column + ` AND bl.blocked_id = ?)
+	)`, []interface{}{viewerID, viewerID}
+}
@@ -0,0 +1,605 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+// MaxChatParticipants caps the size of a group DM, creator included
+const MaxChatParticipants = 10
+
+// MaxChatTitleLength caps the title of a group DM
+const MaxChatTitleLength = 100
+
+// MakeGroupChatHandler creates a group DM between the current user and the invited users
+func (S *Server) MakeGroupChatHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Title        string `json:"title"`
+		Participants []int  `json:"participants"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	title, err := validateChatTitle(body.Title)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+
+	var participants []int
+	seen := map[int]bool{currentUserID: true}
+	for _, userID := range body.Participants {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		participants = append(participants, userID)
+	}
+	if len(participants) < 2 {
+		tools.SendJSONError(w, "a group chat needs at least 2 other participants", http.StatusBadRequest)
+		return
+	}
+	if len(participants)+1 > MaxChatParticipants {
+		tools.SendJSONError(w, fmt.Sprintf("a group chat can have at most %d participants", MaxChatParticipants), http.StatusBadRequest)
+		return
+	}
+	for _, userID := range participants {
+		if !S.CanChatWith(currentUserID, userID) {
+			tools.SendJSONError(w, "You can only add your followers or followings", http.StatusForbidden)
+			return
+		}
+	}
+
+	chatID, err := S.MakeGroupChat(currentUserID, title, participants)
+	if err != nil {
+		fmt.Println("Make Group Chat Error : ", err)
+		tools.SendJSONError(w, "failed to create chat", http.StatusInternalServerError)
+		return
+	}
+
+	for _, userID := range participants {
+		if chat, err := S.GetGroupChat(chatID, userID); err == nil {
+			S.PushNewChat(userID, map[string]interface{}{"user": chat})
+		}
+	}
+
+	chat, err := S.GetGroupChat(chatID, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "failed to get chat", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chat)
+}
+
+// GetChatParticipantsHandler lists the participants of a chat
+func (S *Server) GetChatParticipantsHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ID := r.URL.Path[len("/api/chat-participants/"):]
+	checkChatID, chatID := tools.IsNumeric(ID)
+	if !checkChatID {
+		tools.SendJSONError(w, "invalid chat ID", http.StatusBadRequest)
+		return
+	}
+
+	if !S.CheckIfCaneSendMessage(currentUserID, chatID) {
+		tools.SendJSONError(w, "You are not a member of this chat", http.StatusForbidden)
+		return
+	}
+
+	participants, err := S.GetChatParticipants(chatID)
+	if err != nil {
+		tools.SendJSONError(w, "failed to get participants", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(participants)
+}
+
+// AddChatParticipantHandler lets a participant of a group DM invite one of their followers or followings
+func (S *Server) AddChatParticipantHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		ChatID int `json:"chatId"`
+		UserID int `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := S.requireGroupChat(body.ChatID, currentUserID); err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if S.CheckIfCaneSendMessage(body.UserID, body.ChatID) {
+		tools.SendJSONError(w, "user is already a participant", http.StatusBadRequest)
+		return
+	}
+	if !S.CanChatWith(currentUserID, body.UserID) {
+		tools.SendJSONError(w, "You can only add your followers or followings", http.StatusForbidden)
+		return
+	}
+
+	participants, err := S.GetChatParticipantIDs(body.ChatID)
+	if err != nil {
+		tools.SendJSONError(w, "failed to add participant", http.StatusInternalServerError)
+		return
+	}
+	if len(participants) >= MaxChatParticipants {
+		tools.SendJSONError(w, fmt.Sprintf("a group chat can have at most %d participants", MaxChatParticipants), http.StatusBadRequest)
+		return
+	}
+
+	if err := S.AddChatParticipant(body.ChatID, body.UserID); err != nil {
+		fmt.Println("Add Chat Participant Error : ", err)
+		tools.SendJSONError(w, "failed to add participant", http.StatusInternalServerError)
+		return
+	}
+
+	S.pushChatUpdate(body.ChatID, participants, map[string]interface{}{
+		"chatId": body.ChatID,
+		"action": "add",
+		"userId": currentUserID,
+		"target": body.UserID,
+	})
+	if chat, err := S.GetGroupChat(body.ChatID, body.UserID); err == nil {
+		S.PushNewChat(body.UserID, map[string]interface{}{"user": chat})
+	}
+
+	chat, err := S.GetGroupChat(body.ChatID, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "failed to get chat", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chat)
+}
+
+// RemoveChatParticipantHandler lets the creator of a group DM remove a participant
+func (S *Server) RemoveChatParticipantHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		ChatID int `json:"chatId"`
+		UserID int `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	createdBy, err := S.requireGroupChat(body.ChatID, currentUserID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if createdBy != currentUserID {
+		tools.SendJSONError(w, "Only the creator can remove participants", http.StatusForbidden)
+		return
+	}
+	if body.UserID == currentUserID {
+		tools.SendJSONError(w, "use leave-chat to leave the chat", http.StatusBadRequest)
+		return
+	}
+	if !S.CheckIfCaneSendMessage(body.UserID, body.ChatID) {
+		tools.SendJSONError(w, "user is not a participant", http.StatusNotFound)
+		return
+	}
+
+	participants, _ := S.GetChatParticipantIDs(body.ChatID)
+	if err := S.RemoveChatParticipant(body.ChatID, body.UserID); err != nil {
+		fmt.Println("Remove Chat Participant Error : ", err)
+		tools.SendJSONError(w, "failed to remove participant", http.StatusInternalServerError)
+		return
+	}
+
+	S.pushChatUpdate(body.ChatID, participants, map[string]interface{}{
+		"chatId": body.ChatID,
+		"action": "remove",
+		"userId": currentUserID,
+		"target": body.UserID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"chatId": body.ChatID, "userId": body.UserID})
+}
+
+// LeaveChatHandler removes the current user from a group DM. The oldest remaining participant
+// becomes the creator, and the chat is deleted once nobody is left.
+func (S *Server) LeaveChatHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ID := r.URL.Path[len("/api/leave-chat/"):]
+	checkChatID, chatID := tools.IsNumeric(ID)
+	if !checkChatID {
+		tools.SendJSONError(w, "invalid chat ID", http.StatusBadRequest)
+		return
+	}
+
+	createdBy, err := S.requireGroupChat(chatID, currentUserID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+
+	participants, _ := S.GetChatParticipantIDs(chatID)
+	if err := S.RemoveChatParticipant(chatID, currentUserID); err != nil {
+		fmt.Println("Leave Chat Error : ", err)
+		tools.SendJSONError(w, "failed to leave chat", http.StatusInternalServerError)
+		return
+	}
+
+	event := map[string]interface{}{
+		"chatId": chatID,
+		"action": "leave",
+		"userId": currentUserID,
+	}
+	if createdBy == currentUserID {
+		if newCreator, err := S.transferChatOwnership(chatID); err == nil && newCreator != 0 {
+			event["createdBy"] = newCreator
+		}
+	}
+	S.pushChatUpdate(chatID, participants, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"chatId": chatID})
+}
+
+// RenameChatHandler changes the title of a group DM. Any participant can rename it.
+func (S *Server) RenameChatHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPut, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		ChatID int    `json:"chatId"`
+		Title  string `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := S.requireGroupChat(body.ChatID, currentUserID); err != nil {
+		SendActionError(w, err)
+		return
+	}
+	title, err := validateChatTitle(body.Title)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+
+	if _, err := S.db.Exec(`UPDATE chats SET title = ? WHERE id = ?`, html.EscapeString(title), body.ChatID); err != nil {
+		tools.SendJSONError(w, "failed to rename chat", http.StatusInternalServerError)
+		return
+	}
+
+	participants, _ := S.GetChatParticipantIDs(body.ChatID)
+	S.pushChatUpdate(body.ChatID, participants, map[string]interface{}{
+		"chatId": body.ChatID,
+		"action": "rename",
+		"userId": currentUserID,
+		"title":  html.EscapeString(title),
+	})
+
+	chat, err := S.GetGroupChat(body.ChatID, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "failed to get chat", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chat)
+}
+
+func validateChatTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if len([]rune(title)) > MaxChatTitleLength {
+		return "", NewActionError(http.StatusBadRequest, fmt.Sprintf("title cannot be longer than %d characters", MaxChatTitleLength))
+	}
+	return title, nil
+}
+
+// requireGroupChat checks that chatID is a group DM that userID takes part in, and returns its creator
+func (S *Server) requireGroupChat(chatID, userID int) (int, error) {
+	var isGroup bool
+	var createdBy sql.NullInt64
+	err := S.db.QueryRow(`SELECT is_group, created_by FROM chats WHERE id = ?`, chatID).Scan(&isGroup, &createdBy)
+	if err == sql.ErrNoRows {
+		return 0, NewActionError(http.StatusNotFound, "Chat not found")
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !S.CheckIfCaneSendMessage(userID, chatID) {
+		return 0, NewActionError(http.StatusForbidden, "You are not a member of this chat")
+	}
+	if !isGroup {
+		return 0, NewActionError(http.StatusBadRequest, "not a group chat")
+	}
+	return int(createdBy.Int64), nil
+}
+
+// MakeGroupChat stores a group DM with its creator and participants
+func (S *Server) MakeGroupChat(currentUserID int, title string, participants []int) (int, error) {
+	tx, err := S.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO chats (title, is_group, created_by) VALUES (?, 1, ?)`, html.EscapeString(title), currentUserID)
+	if err != nil {
+		return 0, err
+	}
+	chatID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, userID := range append([]int{currentUserID}, participants...) {
+		if _, err := tx.Exec(`INSERT INTO chat_participants (chat_id, user_id) VALUES (?, ?)`, chatID, userID); err != nil {
+			return 0, err
+		}
+	}
+	return int(chatID), tx.Commit()
+}
+
+// AddChatParticipant adds userID to a chat. Messages sent before they joined count as read.
+func (S *Server) AddChatParticipant(chatID, userID int) error {
+	tx, err := S.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO chat_participants (chat_id, user_id) VALUES (?, ?)`, chatID, userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO chat_reads (chat_id, user_id, last_read_id)
+		VALUES (?, ?, (SELECT COALESCE(MAX(backend_id), 0) FROM messages WHERE chat_id = ?))
+		ON CONFLICT(chat_id, user_id) DO UPDATE SET last_read_id = excluded.last_read_id, read_at = CURRENT_TIMESTAMP
+	`, chatID, userID, chatID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveChatParticipant takes userID out of a chat and stops their live updates for it.
+// A chat left without participants is deleted with its messages and their files.
+func (S *Server) RemoveChatParticipant(chatID, userID int) error {
+	tx, err := S.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM chat_participants WHERE chat_id = ? AND user_id = ?`, chatID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM chat_reads WHERE chat_id = ? AND user_id = ?`, chatID, userID); err != nil {
+		return err
+	}
+
+	var remaining int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM chat_participants WHERE chat_id = ?`, chatID).Scan(&remaining); err != nil {
+		return err
+	}
+	var attachments []string
+	if remaining == 0 {
+		rows, err := tx.Query(`
+			SELECT a.path FROM message_attachments a JOIN messages m ON m.backend_id = a.message_id WHERE m.chat_id = ?
+		`, chatID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var path string
+			if err := rows.Scan(&path); err == nil {
+				attachments = append(attachments, path)
+			}
+		}
+		rows.Close()
+
+		for _, query := range []string{
+			`DELETE FROM message_attachments WHERE message_id IN (SELECT backend_id FROM messages WHERE chat_id = ?)`,
+			`DELETE FROM hidden_messages WHERE message_id IN (SELECT backend_id FROM messages WHERE chat_id = ?)`,
+			`DELETE FROM chat_reads WHERE chat_id = ?`,
+			`DELETE FROM messages WHERE chat_id = ?`,
+			`DELETE FROM chats WHERE id = ?`,
+		} {
+			if _, err := tx.Exec(query, chatID); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, path := range attachments {
+		RemoveUploadedFile(path)
+	}
+
+	S.DropTopic(userID, fmt.Sprintf("chat:%d", chatID))
+	return nil
+}
+
+// transferChatOwnership makes the longest-standing participant the creator of a group DM
+func (S *Server) transferChatOwnership(chatID int) (int, error) {
+	var newCreator int
+	err := S.db.QueryRow(`
+		SELECT user_id FROM chat_participants WHERE chat_id = ? ORDER BY joined_at ASC, rowid ASC LIMIT 1
+	`, chatID).Scan(&newCreator)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	_, err = S.db.Exec(`UPDATE chats SET created_by = ? WHERE id = ?`, newCreator, chatID)
+	return newCreator, err
+}
+
+// pushChatUpdate sends a participant or title change of a group DM to every session of recipients
+func (S *Server) pushChatUpdate(chatID int, recipients []int, event map[string]interface{}) {
+	for _, userID := range recipients {
+		S.PushChatEvent("chat-update", userID, event)
+	}
+}
+
+// GetChatParticipantIDs returns the IDs of everyone taking part in a chat
+func (S *Server) GetChatParticipantIDs(chatID int) ([]int, error) {
+	rows, err := S.db.Query(`SELECT user_id FROM chat_participants WHERE chat_id = ? ORDER BY joined_at ASC`, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetChatParticipants returns the profiles of everyone taking part in a chat
+func (S *Server) GetChatParticipants(chatID int) ([]ChatParticipant, error) {
+	rows, err := S.db.Query(`
+		SELECT u.id, u.first_name || ' ' || u.last_name, u.nickname, COALESCE(u.avatar, ''), u.url, p.joined_at
+		FROM chat_participants p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.chat_id = ?
+		ORDER BY p.joined_at ASC
+	`, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	participants := []ChatParticipant{}
+	for rows.Next() {
+		var p ChatParticipant
+		var username sql.NullString
+		if err := rows.Scan(&p.ID, &p.Name, &username, &p.Avatar, &p.Url, &p.JoinedAt); err != nil {
+			return nil, err
+		}
+		p.Username = username.String
+		participants = append(participants, p)
+	}
+	return participants, rows.Err()
+}
+
+// GetGroupChat returns a group DM as it appears in viewerID's chat list.
+// Untitled chats are named after the other participants.
+func (S *Server) GetGroupChat(chatID, viewerID int) (Chat, error) {
+	var chat Chat
+	var title sql.NullString
+	var createdBy sql.NullInt64
+	err := S.db.QueryRow(`
+		SELECT c.id, c.title, c.created_by, `+chatUnreadSQL+`
+		FROM chats c WHERE c.id = ? AND c.is_group = 1
+	`, viewerID, viewerID, viewerID, chatID).Scan(&chat.ChatID, &title, &createdBy, &chat.UnreadCount)
+	if err != nil {
+		return Chat{}, err
+	}
+
+	chat.IsGroup = true
+	chat.Title = title.String
+	chat.CreatedBy = int(createdBy.Int64)
+	chat.Participants, err = S.GetChatParticipants(chatID)
+	if err != nil {
+		return Chat{}, err
+	}
+
+	chat.Name = chat.Title
+	if chat.Name == "" {
+		var names []string
+		for _, p := range chat.Participants {
+			if p.ID != viewerID {
+				names = append(names, p.Name)
+			}
+		}
+		chat.Name = strings.Join(names, ", ")
+	}
+	return chat, nil
+}
+
+// GetGroupChats returns the group DMs currentUserID takes part in
+func (S *Server) GetGroupChats(currentUserID int) ([]Chat, error) {
+	rows, err := S.db.Query(`
+		SELECT c.id FROM chats c
+		JOIN chat_participants p ON p.chat_id = c.id AND p.user_id = ?
+		WHERE c.is_group = 1
+		ORDER BY c.created_at DESC
+	`, currentUserID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var chats []Chat
+	for _, id := range ids {
+		chat, err := S.GetGroupChat(id, currentUserID)
+		if err != nil {
+			return nil, err
+		}
+		chats = append(chats, chat)
+	}
+	return chats, nil
+}
@@ -7,9 +7,14 @@ import (
 	"fmt"
 	"html"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// MaxCommentDepth is how many levels a thread can have, top-level comments included
+const MaxCommentDepth = 3
+
 func (S *Server) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
 	if banned {
@@ -30,6 +35,9 @@ func (S *Server) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Content cannot be empty", http.StatusBadRequest)
 		return
 	}
+	if commnet.Type == "" {
+		commnet.Type = "text"
+	}
 
 	authorized, err := S.CheckPostPrivacy(commnet.PostID, 0, currentUserID, "")
 	if err != nil {
@@ -41,29 +49,72 @@ func (S *Server) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	depth := 0
+	parentAuthorID := 0
+	if commnet.ParentCommentID != nil {
+		var parentPostID, parentDepth int
+		err := S.db.QueryRow(`SELECT post_id, depth, user_id FROM comments WHERE id = ?`, *commnet.ParentCommentID).Scan(&parentPostID, &parentDepth, &parentAuthorID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				tools.SendJSONError(w, "Parent comment not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to get parent comment", http.StatusInternalServerError)
+			return
+		}
+		if blocked, err := S.IsBlocked(parentAuthorID, currentUserID); err != nil || blocked {
+			tools.SendJSONError(w, "Parent comment not found", http.StatusNotFound)
+			return
+		}
+		if parentPostID != commnet.PostID {
+			S.RecordStrike(r, currentUserID, "replying to a comment of another post")
+			tools.SendJSONError(w, "Parent comment belongs to another post", http.StatusBadRequest)
+			return
+		}
+		depth = parentDepth + 1
+		if depth >= MaxCommentDepth {
+			tools.SendJSONError(w, "Maximum reply depth reached", http.StatusBadRequest)
+			return
+		}
+	}
+
 	if commnet.Type != "text" && tools.ContainsHTML(commnet.Content) {
-		S.ActionMiddleware(r, http.MethodPost, true, true)
+		S.RecordStrike(r, currentUserID, "HTML in a non-text comment")
 		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
 		return
-	} else if commnet.Type == "text" && tools.ContainsHTML(commnet.Content) {
+	}
+	// text and emoji comments are stored escaped like posts, which the search index relies on
+	if commnet.Type == "text" || commnet.Type == "emoji" {
 		commnet.Content = html.EscapeString(commnet.Content)
 	}
 
-	commentID, err := S.CreateComment(currentUserID, commnet)
+	commentID, err := S.CreateComment(currentUserID, commnet, depth)
 	if err != nil {
 		http.Error(w, "Failed to create comment", http.StatusInternalServerError)
 		return
 	}
 
-	comment, err := S.GetCommentByID(commentID)
+	if commnet.Subscribe {
+		if err := S.SubscribeToComments(commnet.PostID, currentUserID); err != nil {
+			fmt.Println("Error subscribing to comments:", err)
+		}
+	}
+
+	comment, err := S.GetCommentByID(commentID, currentUserID)
 	if err != nil {
 		http.Error(w, "Failed to get comment", http.StatusInternalServerError)
 		return
 	}
+
+	S.NotifyNewComment(commnet.PostID, currentUserID, parentAuthorID)
+	S.PushComment("-new", commnet.PostID, currentUserID, comment)
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(comment)
 }
 
+// GetCommentsHandler returns the top-level comments of a post, or the direct
+// replies of one comment when ?parent={commentID} is given
 func (S *Server) GetCommentsHandler(w http.ResponseWriter, r *http.Request) {
 	banned, currentUserID := S.ActionMiddleware(r, http.MethodGet, true, false)
 	if banned {
@@ -88,92 +139,469 @@ func (S *Server) GetCommentsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comments, err := S.GetComments((postID))
+	parentID := 0
+	if parent := r.URL.Query().Get("parent"); parent != "" {
+		checkParent, id := tools.IsNumeric(parent)
+		if !checkParent {
+			tools.SendJSONError(w, "Invalid parent comment ID", http.StatusBadRequest)
+			return
+		}
+		parentID = id
+	}
+
+	page, err := ParsePage(r)
+	if err != nil {
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comments, nextCursor, err := S.GetComments(postID, parentID, currentUserID, page)
 	if err != nil {
 		http.Error(w, "Failed to get comments", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(comments)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comments":   comments,
+		"nextCursor": nextCursor,
+	})
+}
+
+// EditCommentHandler lets the author change the content of a comment
+func (S *Server) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPut, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(body.Content) == "" {
+		tools.SendJSONError(w, "Content cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	var authorID, postID int
+	var commentType string
+	err := S.db.QueryRow(`SELECT user_id, type, post_id FROM comments WHERE id = ?`, body.ID).Scan(&authorID, &commentType, &postID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			tools.SendJSONError(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if authorID != currentUserID {
+		S.RecordStrike(r, currentUserID, "editing another user's comment")
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if commentType != "text" && tools.ContainsHTML(body.Content) {
+		S.RecordStrike(r, currentUserID, "HTML in a non-text comment")
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	// text and emoji comments are stored escaped like posts, which the search index relies on
+	if commentType == "text" || commentType == "emoji" {
+		body.Content = html.EscapeString(body.Content)
+	}
+
+	_, err = S.db.Exec(`UPDATE comments SET content = ?, edited_at = CURRENT_TIMESTAMP WHERE id = ?`, body.Content, body.ID)
+	if err != nil {
+		tools.SendJSONError(w, "Failed to update comment", http.StatusInternalServerError)
+		return
+	}
+
+	if commentType == "text" {
+		if err := IndexCommentHashtags(S.db, body.ID, postID, body.Content); err != nil {
+			fmt.Println("Error indexing hashtags:", err)
+		}
+		S.UpdateMentions("comment", body.ID, currentUserID, body.Content)
+	}
+
+	comment, err := S.GetCommentByID(body.ID, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Failed to get comment", http.StatusInternalServerError)
+		return
+	}
+
+	S.PushComment("-edit", comment.PostID, currentUserID, comment)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// DeleteCommentHandler deletes a comment and all of its replies.
+// Allowed for the comment's author and for the author of the post.
+func (S *Server) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodDelete, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ID := r.URL.Path[len("/api/delete-comment/"):]
+	checkCommentID, commentID := tools.IsNumeric(ID)
+	if !checkCommentID {
+		tools.SendJSONError(w, "invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	var authorID, postID int
+	err := S.db.QueryRow(`SELECT user_id, post_id FROM comments WHERE id = ?`, commentID).Scan(&authorID, &postID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			tools.SendJSONError(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	postAuthorID, err := S.GetUserIdFromPostID(postID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if authorID != currentUserID && postAuthorID != currentUserID {
+		S.RecordStrike(r, currentUserID, "deleting another user's comment")
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	files, err := S.DeleteCommentThread(commentID)
+	if err != nil {
+		fmt.Println("Error deleting comment:", err)
+		tools.SendJSONError(w, "Failed to delete comment", http.StatusInternalServerError)
+		return
+	}
+
+	for _, file := range files {
+		if err := RemoveUploadedFile(file); err != nil {
+			fmt.Println("Error removing comment file:", err)
+		}
+	}
+
+	S.PushComment("-delete", postID, authorID, map[string]interface{}{
+		"postId":    postID,
+		"commentId": commentID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "comment deleted"})
 }
 
-func (S *Server) CreateComment(userID int, comment CommentRequest) (int, error) {
-	sqlRes, err := S.db.Exec("INSERT INTO comments (user_id, content, post_id, type) VALUES (?, ?, ?, ?)", userID, comment.Content, comment.PostID, comment.Type)
+// SubscribeCommentsHandler opts the current user in to notifications for every new comment on a post
+func (S *Server) SubscribeCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ID := r.URL.Path[len("/api/subscribe-comments/"):]
+	checkPostID, postID := tools.IsNumeric(ID)
+	if !checkPostID {
+		tools.SendJSONError(w, "invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	authorized, err := S.CheckPostPrivacy(postID, 0, currentUserID, "")
+	if err != nil {
+		if err == sql.ErrNoRows {
+			tools.SendJSONError(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		tools.SendJSONError(w, "Failed to validate post privacy", http.StatusInternalServerError)
+		return
+	}
+	if !authorized {
+		tools.SendJSONError(w, "Unauthorized to view this post", http.StatusUnauthorized)
+		return
+	}
+
+	if err := S.SubscribeToComments(postID, currentUserID); err != nil {
+		tools.SendJSONError(w, "Failed to subscribe", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"postId": postID, "subscribed": true})
+}
+
+// UnsubscribeCommentsHandler stops comment notifications for a post
+func (S *Server) UnsubscribeCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodDelete, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ID := r.URL.Path[len("/api/unsubscribe-comments/"):]
+	checkPostID, postID := tools.IsNumeric(ID)
+	if !checkPostID {
+		tools.SendJSONError(w, "invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	_, err := S.db.Exec(`DELETE FROM comment_subscriptions WHERE post_id = ? AND user_id = ?`, postID, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Failed to unsubscribe", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"postId": postID, "subscribed": false})
+}
+
+func (S *Server) SubscribeToComments(postID, userID int) error {
+	_, err := S.db.Exec(`INSERT OR IGNORE INTO comment_subscriptions (post_id, user_id) VALUES (?, ?)`, postID, userID)
+	return err
+}
+
+// NotifyNewComment notifies the post author and the subscribed users of a new comment on postID.
+// When the comment is a reply, the parent comment's author gets a "reply" notification instead.
+func (S *Server) NotifyNewComment(postID, actorID, parentAuthorID int) {
+	postAuthorID, err := S.GetUserIdFromPostID(postID)
+	if err != nil {
+		fmt.Println("Error getting post author:", err)
+		return
+	}
+
+	notified := map[int]bool{actorID: true}
+	notify := func(userID int, notifType, content string) {
+		if userID == 0 || notified[userID] {
+			return
+		}
+		notified[userID] = true
+		if blocked, err := S.IsBlocked(userID, actorID); err != nil || blocked {
+			return
+		}
+		notification := Notification{
+			ID:          userID,
+			ActorID:     actorID,
+			Type:        notifType,
+			Content:     content,
+			IsRead:      false,
+			CreatedAt:   time.Now(),
+			ReferenceID: postID,
+		}
+		if err := S.InsertNotification(notification); err != nil {
+			fmt.Println("Error inserting notification:", err)
+			return
+		}
+		S.PushNotification("-new", userID, notification)
+	}
+
+	notify(parentAuthorID, "reply", "Replied to your comment")
+	notify(postAuthorID, "comment", "Commented on your post")
+
+	rows, err := S.db.Query(`SELECT user_id FROM comment_subscriptions WHERE post_id = ?`, postID)
+	if err != nil {
+		fmt.Println("Error getting comment subscribers:", err)
+		return
+	}
+	var subscribers []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err == nil {
+			subscribers = append(subscribers, userID)
+		}
+	}
+	rows.Close()
+
+	for _, userID := range subscribers {
+		// the post may have become private since they subscribed
+		if allowed, err := S.CheckPostPrivacy(postID, postAuthorID, userID, ""); err != nil || !allowed {
+			continue
+		}
+		notify(userID, "comment", "Commented on a post you follow")
+	}
+}
+
+// commentThreadSQL selects the ids of a comment and all of its replies
+const commentThreadSQL = `
+	WITH RECURSIVE thread(id) AS (
+		SELECT id FROM comments WHERE id = ?
+		UNION ALL
+		SELECT c.id FROM comments c JOIN thread t ON c.parent_id = t.id
+	)`
+
+// DeleteCommentThread deletes a comment with its replies and returns the uploaded
+// files they used so the caller can remove them
+func (S *Server) DeleteCommentThread(commentID int) ([]string, error) {
+	tx, err := S.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(commentThreadSQL+`
+		SELECT content FROM comments
+		WHERE id IN (SELECT id FROM thread) AND type IN ('image', 'gif')
+	`, commentID)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for rows.Next() {
+		var file string
+		if err := rows.Scan(&file); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(commentThreadSQL+`
+		DELETE FROM comment_hashtags WHERE comment_id IN (SELECT id FROM thread)
+	`, commentID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(commentThreadSQL+`
+		DELETE FROM mentions WHERE source = 'comment' AND source_id IN (SELECT id FROM thread)
+	`, commentID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(commentThreadSQL+`
+		DELETE FROM comments WHERE id IN (SELECT id FROM thread)
+	`, commentID); err != nil {
+		return nil, err
+	}
+
+	return files, tx.Commit()
+}
+
+func (S *Server) CreateComment(userID int, comment CommentRequest, depth int) (int, error) {
+	sqlRes, err := S.db.Exec("INSERT INTO comments (user_id, content, post_id, type, parent_id, depth) VALUES (?, ?, ?, ?, ?, ?)", userID, comment.Content, comment.PostID, comment.Type, comment.ParentCommentID, depth)
 	if err != nil {
 		return 0, err
 	}
 	lastID, _ := sqlRes.LastInsertId()
+	if comment.Type == "text" {
+		if err := IndexCommentHashtags(S.db, int(lastID), comment.PostID, comment.Content); err != nil {
+			fmt.Println("Error indexing hashtags:", err)
+		}
+		S.UpdateMentions("comment", int(lastID), userID, comment.Content)
+	}
 	return int(lastID), nil
 }
 
-func (S *Server) GetComments(postID int) ([]Comment, error) {
+// commentColumns is the SELECT list read by scanComment
+const commentColumns = `
+			c.id, c.post_id, c.parent_id, c.depth, c.content, c.created_at, c.edited_at, c.type, c.user_id,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count,
+			u.first_name || ' ' || u.last_name AS name,
+			u.nickname, u.avatar`
+
+func scanComment(row interface{ Scan(...interface{}) error }, currentUserID int) (Comment, error) {
+	var comment Comment
+	var authorID int
+	var parentID sql.NullInt64
+	var editedAt, commentType, authorName, authorUsername, authorAvatar sql.NullString
+
+	if err := row.Scan(
+		&comment.ID,
+		&comment.PostID,
+		&parentID,
+		&comment.Depth,
+		&comment.Content,
+		&comment.CreatedAt,
+		&editedAt,
+		&commentType,
+		&authorID,
+		&comment.Replies,
+		&authorName,
+		&authorUsername,
+		&authorAvatar,
+	); err != nil {
+		return Comment{}, err
+	}
+
+	comment.ParentID = int(parentID.Int64)
+	comment.EditedAt = editedAt.String
+	comment.Type = commentType.String
+	comment.IsOwn = authorID == currentUserID
+
+	// author
+	comment.Author.Name = authorName.String
+	comment.Author.Username = authorUsername.String
+	comment.Author.Avatar = authorAvatar.String
+
+	return comment, nil
+}
+
+// GetComments returns one page of a post's comments, oldest first, and the cursor of the following page.
+// Comments of blocked users and of users whose comments the current user muted are left out.
+// parentID 0 lists top-level comments, otherwise the direct replies of that comment.
+func (S *Server) GetComments(postID, parentID, currentUserID int, page Page) ([]Comment, string, error) {
+	parentCondition := `c.parent_id IS NULL`
+	args := []interface{}{postID}
+	if parentID != 0 {
+		parentCondition = `c.parent_id = ?`
+		args = append(args, parentID)
+	}
+
+	notBlocked, notBlockedArgs := NotBlockedCondition("c.user_id", currentUserID)
+	notMuted, notMutedArgs := NotMutedCondition("comments", "c.user_id", currentUserID)
+	condition, conditionArgs := page.Condition("c.created_at", "c.id")
+	args = append(append(args, notBlockedArgs...), notMutedArgs...)
+	args = append(append(args, conditionArgs...), page.Limit+1)
 	rows, err := S.db.Query(`
-		SELECT 
-			c.id, c.content, c.created_at, c.type,
-			u.first_name || ' ' || u.last_name AS name, 
-			u.nickname, u.avatar
+		SELECT `+commentColumns+`
 		FROM comments c
 		JOIN users u ON c.user_id = u.id
-		WHERE c.post_id = ?
-		ORDER BY c.created_at ASC
-	`, postID)
+		WHERE c.post_id = ? AND `+parentCondition+` AND `+notBlocked+` AND `+notMuted+` AND `+condition+`
+		ORDER BY `+page.OrderBy("c.created_at", "c.id", false)+`
+		LIMIT ?
+	`, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 	var allComments []Comment
 
 	for rows.Next() {
-		var comment Comment
-		var authorName, authorUsername, authorAvatar sql.NullString
-
-		if err := rows.Scan(
-			&comment.ID,
-			&comment.Content,
-			&comment.CreatedAt,
-			&authorName,
-			&authorUsername,
-			&authorAvatar,
-			&comment.Type,
-		); err != nil {
-			return nil, err
+		comment, err := scanComment(rows, currentUserID)
+		if err != nil {
+			return nil, "", err
 		}
-
-		// author
-		comment.Author.Name = authorName.String
-		comment.Author.Username = authorUsername.String
-		comment.Author.Avatar = authorAvatar.String
-
 		allComments = append(allComments, comment)
-
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
 	}
 
-	return allComments, nil
+	allComments, nextCursor := FinishPage(page, allComments, false, func(comment Comment) string {
+		id, _ := strconv.Atoi(comment.ID)
+		return EncodeCursor(id, comment.CreatedAt)
+	})
+	return allComments, nextCursor, nil
 }
 
-func (S *Server) GetCommentByID(commentID int) (Comment, error) {
+func (S *Server) GetCommentByID(commentID, currentUserID int) (Comment, error) {
 	row := S.db.QueryRow(`
-		SELECT 
-			c.id, c.content, c.created_at,
-			u.first_name || ' ' || u.last_name AS name, 
-			u.nickname, u.avatar
+		SELECT `+commentColumns+`
 		FROM comments c
 		JOIN users u ON c.user_id = u.id
 		WHERE c.id = ?
 	`, commentID)
 
-	var comment Comment
-	var authorName, authorUsername, authorAvatar sql.NullString
-
-	err := row.Scan(
-		&comment.ID,
-		&comment.Content,
-		&comment.CreatedAt,
-		&authorName,
-		&authorUsername,
-		&authorAvatar,
-	)
+	comment, err := scanComment(row, currentUserID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Comment{}, nil // comment not found
@@ -182,11 +610,6 @@ func (S *Server) GetCommentByID(commentID int) (Comment, error) {
 		return Comment{}, err
 	}
 
-	// author
-	comment.Author.Name = authorName.String
-	comment.Author.Username = authorUsername.String
-	comment.Author.Avatar = authorAvatar.String
-
 	return comment, nil
 }
 func (S *Server) GetCommentAuthorID(commentID int) (int, error) {
@@ -0,0 +1,338 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// purposes of email_tokens
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+	TokenChangeEmail   = "change_email"
+)
+
+// AppURL is where the frontend is served, used for the links in emails
+var AppURL = "http://localhost:3000"
+
+// how long mailed tokens stay valid
+var (
+	EmailVerificationTTL = 24 * time.Hour
+	PasswordResetTTL     = time.Hour
+	EmailChangeTTL       = 24 * time.Hour
+)
+
+// EmailTokenCooldown is how long a user waits before another email of the same kind is sent
+var EmailTokenCooldown = time.Minute
+
+// VerifyEmailHandler marks the account of a verification token as verified
+func (S *Server) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	banned, _ := S.ActionMiddleware(r, http.MethodPost, false, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		tools.SendJSONError(w, "failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := ConsumeEmailToken(tx, body.Token, TokenVerifyEmail)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if _, err := tx.Exec(`UPDATE users SET email_verified = 1 WHERE id = ?`, userID); err != nil {
+		tools.SendJSONError(w, "failed to verify email", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tools.SendJSONError(w, "failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "email verified"})
+}
+
+// ResendVerificationHandler mails the current user a new verification link
+func (S *Server) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var email string
+	var verified bool
+	if err := S.db.QueryRow(`SELECT email, email_verified FROM users WHERE id = ?`, currentUserID).Scan(&email, &verified); err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if verified {
+		tools.SendJSONError(w, "email already verified", http.StatusBadRequest)
+		return
+	}
+	if S.EmailTokenCoolingDown(currentUserID, TokenVerifyEmail) {
+		tools.SendJSONError(w, "please wait before requesting another email", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := S.SendVerificationEmail(currentUserID, email); err != nil {
+		fmt.Println("Resend Verification Error : ", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "verification email sent"})
+}
+
+// ForgotPasswordHandler mails a password reset link when the address belongs to an account.
+// The response is the same either way so it cannot be used to find registered addresses.
+func (S *Server) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	banned, _ := S.ActionMiddleware(r, http.MethodPost, false, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	var userID int
+	var email string
+	err := S.db.QueryRow(`SELECT id, email FROM users WHERE email = ?`, tools.ToLower(body.Email)).Scan(&userID, &email)
+	if err != nil && err != sql.ErrNoRows {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err == nil && !S.EmailTokenCoolingDown(userID, TokenResetPassword) {
+		token, err := S.IssueEmailToken(userID, TokenResetPassword, "", PasswordResetTTL)
+		if err != nil {
+			fmt.Println("Forgot Password Error : ", err)
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		S.SendMail(email, "Reset your password", fmt.Sprintf(
+			"Someone asked to reset the password of your account.\n\nChoose a new password here within %s:\n%s/reset-password?token=%s\n\nIf it was not you, ignore this email.",
+			PasswordResetTTL, AppURL, token))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "if this address is registered, a reset link has been sent"})
+}
+
+// ResetPasswordHandler sets a new password from a reset token and logs the account out everywhere.
+// Following the link proves the address, so the account is verified too.
+func (S *Server) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	banned, _ := S.ActionMiddleware(r, http.MethodPost, false, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if !tools.IsValidPassword(body.Password) {
+		tools.SendJSONError(w, "password must be at least 8 characters with an uppercase letter, a lowercase letter and a number", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		tools.SendJSONError(w, "failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := ConsumeEmailToken(tx, body.Token, TokenResetPassword)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	queries := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE users SET password = ?, email_verified = 1 WHERE id = ?`, []interface{}{hashedPassword, userID}},
+		{`DELETE FROM sessions WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM email_tokens WHERE user_id = ? AND purpose = ? AND used_at IS NULL`, []interface{}{userID, TokenResetPassword}},
+		// the owner proved access to the mailbox, so a lockout no longer applies
+		{`DELETE FROM login_throttles WHERE key = ?`, []interface{}{"user:" + strconv.Itoa(userID)}},
+	}
+	for _, q := range queries {
+		if _, err := tx.Exec(q.query, q.args...); err != nil {
+			fmt.Println("Reset Password Error : ", err)
+			tools.SendJSONError(w, "failed to reset password", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tools.SendJSONError(w, "failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+	S.DisconnectRevokedClients(userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "password reset"})
+}
+
+// VerifiedMiddleware is AuthMiddleware for actions unverified accounts may not take:
+// they can log in and look around, but not post, comment, message, follow or join groups
+func (S *Server) VerifiedMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return S.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		userID, _, _ := S.CheckSession(r)
+		if err := S.CheckVerified(userID); err != nil {
+			SendActionError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CheckVerified returns a 403 ActionError when userID has not verified their email address.
+// Actions reachable over the websocket call it themselves, as they skip VerifiedMiddleware.
+func (S *Server) CheckVerified(userID int) error {
+	var verified bool
+	if err := S.db.QueryRow(`SELECT email_verified FROM users WHERE id = ?`, userID).Scan(&verified); err != nil {
+		return err
+	}
+	if !verified {
+		return NewActionError(http.StatusForbidden, "verify your email address first")
+	}
+	return nil
+}
+
+// SendVerificationEmail issues a verification token for userID and mails its link to email
+func (S *Server) SendVerificationEmail(userID int, email string) error {
+	token, err := S.IssueEmailToken(userID, TokenVerifyEmail, "", EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	S.SendMail(email, "Verify your email address", fmt.Sprintf(
+		"Welcome! Confirm your email address within %s to start posting, commenting and chatting:\n%s/verify-email?token=%s",
+		EmailVerificationTTL, AppURL, token))
+	return nil
+}
+
+// IssueEmailToken stores a new token of purpose for userID, valid for ttl, and returns it.
+// newEmail is kept with change_email tokens and empty otherwise.
+// Earlier unused tokens of the same purpose stop working.
+func (S *Server) IssueEmailToken(userID int, purpose, newEmail string, ttl time.Duration) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM email_tokens WHERE user_id = ? AND purpose = ? AND used_at IS NULL`, userID, purpose); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO email_tokens (user_id, purpose, token_hash, expires_at, new_email) VALUES (?, ?, ?, ?, NULLIF(?, ''))
+	`, userID, purpose, hashToken(token), time.Now().Add(ttl).UTC().Format("2006-01-02 15:04:05"), newEmail); err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// ConsumeEmailToken marks a valid token of purpose as used and returns its user.
+// Unknown, expired and already used tokens give a 400 ActionError.
+func ConsumeEmailToken(tx *sql.Tx, token, purpose string) (int, error) {
+	invalid := NewActionError(http.StatusBadRequest, "invalid or expired token")
+	if token == "" {
+		return 0, invalid
+	}
+
+	var id, userID int
+	err := tx.QueryRow(`
+		SELECT id, user_id FROM email_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > datetime('now')
+	`, hashToken(token), purpose).Scan(&id, &userID)
+	if err == sql.ErrNoRows {
+		return 0, invalid
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`UPDATE email_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL`, id)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, invalid
+	}
+	return userID, nil
+}
+
+// EmailTokenCoolingDown reports whether a token of purpose was issued to userID too recently
+// to send another
+func (S *Server) EmailTokenCoolingDown(userID int, purpose string) bool {
+	var recent bool
+	err := S.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM email_tokens WHERE user_id = ? AND purpose = ? AND created_at > ?)
+	`, userID, purpose, time.Now().Add(-EmailTokenCooldown).UTC().Format("2006-01-02 15:04:05")).Scan(&recent)
+	if err != nil {
+		fmt.Println("Email Token Cooldown Error : ", err)
+		return false
+	}
+	return recent
+}
+
+// newToken returns 32 random bytes as hex, for tokens handed to users
+func newToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
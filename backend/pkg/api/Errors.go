@@ -0,0 +1,37 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"fmt"
+	"net/http"
+)
+
+// ActionError is a refused action together with the HTTP status it maps to.
+// WebSocket error frames report the same status and message.
+type ActionError struct {
+	Status  int
+	Message string
+}
+
+func (e *ActionError) Error() string {
+	return e.Message
+}
+
+func NewActionError(status int, message string) *ActionError {
+	return &ActionError{Status: status, Message: message}
+}
+
+// SendActionError writes err as a JSON error, hiding anything that is not an ActionError
+// or a LoginLockedError
+func SendActionError(w http.ResponseWriter, err error) {
+	if actionErr, ok := err.(*ActionError); ok {
+		tools.SendJSONError(w, actionErr.Message, actionErr.Status)
+		return
+	}
+	if lockedErr, ok := err.(*LoginLockedError); ok {
+		SendLoginLocked(w, lockedErr.Until)
+		return
+	}
+	fmt.Println("Internal error:", err)
+	tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+}
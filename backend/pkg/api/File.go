@@ -3,6 +3,7 @@ package backend
 import (
 	tools "SOCIAL-NETWORK/pkg"
 	"bytes"
+	"database/sql"
 	"fmt"
 	"io"
 	"net/http"
@@ -29,8 +30,10 @@ func (S *Server) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var userID int
 	if uploadType != "avatar" {
-		_, _, err := S.CheckSession(r)
+		var err error
+		userID, _, err = S.CheckSession(r)
 		if err != nil {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
@@ -83,6 +86,12 @@ func (S *Server) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		fmt.Println("Error creating upload folder:", err)
+		tools.SendJSONError(w, "Cannot save file", http.StatusInternalServerError)
+		return
+	}
+
 	// unify name creation
 	filePath := folder + uuid.NewV4().String() + ext
 
@@ -97,11 +106,23 @@ func (S *Server) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer out.Close()
 
-	if _, err := io.Copy(out, reader); err != nil {
+	size, err := io.Copy(out, reader)
+	if err != nil {
 		tools.SendJSONError(w, "Failed to save file", http.StatusInternalServerError)
 		return
 	}
 
+	// message files are private to the chat they are sent in
+	if uploadType == "message" {
+		if err := S.RecordAttachment(userID, "/"+filePath, contentType, size); err != nil {
+			fmt.Println("Error recording attachment:", err)
+			out.Close()
+			RemoveUploadedFile(filePath)
+			tools.SendJSONError(w, "Failed to save file", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// return JSON name depending on upload type
 	respKey := map[string]string{
 		"avatar":  "avatarUrl",
@@ -114,6 +135,19 @@ func (S *Server) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(fmt.Sprintf(`{"%s": "/%s"}`, respKey, filePath)))
 }
 
+// RemoveUploadedFile deletes a file saved by UploadFileHandler.
+// Anything outside uploads/ (external gifs, the default avatar) is left alone.
+func RemoveUploadedFile(filePath string) error {
+	filePath = strings.TrimPrefix(filePath, "/")
+	if !strings.HasPrefix(filePath, "uploads/") || strings.Contains(filePath, "..") || filePath == "uploads/default.jpg" {
+		return nil
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (S *Server) ProtectedFileHandler(w http.ResponseWriter, r *http.Request) {
 	banned, userID := S.ActionMiddleware(r, http.MethodGet, true, false)
 	if banned {
@@ -183,16 +217,36 @@ func (S *Server) isAvatarFileAccessible(userID int, filePath string) (bool, erro
 	return avatarPath == filePath, nil
 }
 
+// isMessageFileAccessible lets the participants of a chat, or the members of a group, see the
+// files sent in it. A file that was not sent yet is only visible to its uploader.
 func (S *Server) isMessageFileAccessible(userID int, filePath string) (bool, error) {
-	var count int
+	var uploaderID int
+	var messageID, groupMessageID sql.NullInt64
 	err := S.db.QueryRow(`
-		SELECT COUNT(*) FROM messages
-		WHERE image = ? AND (sender_id = ? OR receiver_id = ?)
-	`, filePath, userID, userID).Scan(&count)
+		SELECT uploader_id, message_id, group_message_id FROM message_attachments WHERE path = ?
+	`, "/"+filePath).Scan(&uploaderID, &messageID, &groupMessageID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
-	return count > 0, nil
+
+	switch {
+	case messageID.Valid:
+		var chatID int
+		if err := S.db.QueryRow(`SELECT chat_id FROM messages WHERE backend_id = ?`, messageID.Int64).Scan(&chatID); err != nil {
+			return false, err
+		}
+		return S.CheckIfCaneSendMessage(userID, chatID), nil
+	case groupMessageID.Valid:
+		var groupID int
+		if err := S.db.QueryRow(`SELECT group_id FROM group_messages WHERE id = ?`, groupMessageID.Int64).Scan(&groupID); err != nil {
+			return false, err
+		}
+		return S.IsGroupMember(groupID, userID)
+	}
+	return uploaderID == userID, nil
 }
 
 func (S *Server) isPostFileAccessible(userID int, filePath string) (bool, error) {
@@ -245,6 +299,22 @@ func (S *Server) CheckPostPrivacy(postID, AuthorID, currentUserID int, privacy s
 		return true, nil
 	}
 
+	if blocked, err := S.IsBlocked(AuthorID, currentUserID); err != nil || blocked {
+		return false, err
+	}
+	if suspended, err := S.IsSuspended(AuthorID); err != nil || suspended {
+		return false, err
+	}
+
+	// group posts are only visible to the group's members
+	var groupID sql.NullInt64
+	if err := S.db.QueryRow(`SELECT group_id FROM posts WHERE id = ?`, postID).Scan(&groupID); err != nil {
+		return false, err
+	}
+	if groupID.Valid {
+		return S.IsGroupMember(int(groupID.Int64), currentUserID)
+	}
+
 	if privacy == "" {
 		err := S.db.QueryRow(`SELECT privacy FROM posts WHERE id = ?`, postID).Scan(&privacy)
 		if err != nil {
@@ -256,21 +326,9 @@ func (S *Server) CheckPostPrivacy(postID, AuthorID, currentUserID int, privacy s
 	case "public":
 		return true, nil
 	case "almost-private":
-		isFollowing, err := S.IsFollowing(currentUserID, "", AuthorID)
-		if err != nil {
-			return false, err
-		}
-		if !isFollowing {
-			return false, nil
-		}
+		return S.IsFollowing(currentUserID, "", AuthorID)
 	case "private":
-		UserAllowed, err := S.UserAllowedToSeePost(currentUserID, postID)
-		if err != nil {
-			return false, err
-		}
-		if AuthorID != currentUserID && !UserAllowed {
-			return false, nil
-		}
+		return S.UserAllowedToSeePost(currentUserID, postID)
 	}
-	return AuthorID == currentUserID, nil
+	return false, nil
 }
@@ -38,7 +38,7 @@ func (S *Server) CancelFollowRequestHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	if followerID == followingID || UserID != followerID {
-		S.ActionMiddleware(r, http.MethodPost, true, true)
+		S.RecordStrike(r, UserID, "forged follower id")
 		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -83,11 +83,16 @@ func (S *Server) AcceptFollowRequestHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	if UserID != FollowingID {
-		S.ActionMiddleware(r, http.MethodPost, true, true)
+		S.RecordStrike(r, UserID, "accepting a follow request sent to another user")
 		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	if blocked, err := S.IsBlocked(FollowerID, FollowingID); err != nil || blocked {
+		tools.SendJSONError(w, "cannot accept this follow request", http.StatusForbidden)
+		return
+	}
+
 	tx, err := S.db.Begin()
 	if err != nil {
 		tools.SendJSONError(w, "failed to start transaction", http.StatusInternalServerError)
@@ -162,7 +167,7 @@ func (S *Server) DeclineFollowRequestHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	if UserID != FollowingID {
-		S.ActionMiddleware(r, http.MethodPost, true, true)
+		S.RecordStrike(r, UserID, "declining a follow request sent to another user")
 		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -219,11 +224,16 @@ func (S *Server) SendFollowRequestHandler(w http.ResponseWriter, r *http.Request
 	if req.Follower == req.Following || UserID != followerID || S.ContainsHTML([]byte(req.Follower)) || S.ContainsHTML([]byte(req.Following)) {
 
 		fmt.Printf("Invalid request: follower=%s, following=%s, UserID=%d, followerID=%d\n", req.Follower, req.Following, UserID, followerID)
-		S.ActionMiddleware(r, http.MethodPost, true, true)
+		S.RecordStrike(r, UserID, "forged follow request")
 		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	if blocked, err := S.IsBlocked(followerID, followingID); err != nil || blocked {
+		tools.SendJSONError(w, "cannot follow this user", http.StatusForbidden)
+		return
+	}
+
 	// check duplicate
 	var exists int
 	err := S.db.QueryRow(`
@@ -307,11 +317,16 @@ func (S *Server) FollowHandler(w http.ResponseWriter, r *http.Request) {
 	if UserId != followerID || followerID == followingID {
 
 		fmt.Printf("Unauthorized access: UserId=%d, followerID=%d, followingID=%d\n", UserId, followerID, followingID)
-		S.ActionMiddleware(r, http.MethodPost, true, true)
+		S.RecordStrike(r, UserId, "forged follower id")
 		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	if blocked, err := S.IsBlocked(followerID, followingID); err != nil || blocked {
+		tools.SendJSONError(w, "cannot follow this user", http.StatusForbidden)
+		return
+	}
+
 	if err := S.FollowUser(body.Follower, body.Following); err != nil {
 
 		fmt.Printf("Error following user: %v\n", err)
@@ -369,7 +384,7 @@ func (S *Server) UnfollowHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if UserId != followerID || followerID == followingID {
-		S.ActionMiddleware(r, http.MethodPost, true, true)
+		S.RecordStrike(r, UserId, "forged follower id")
 		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -93,6 +93,9 @@ func (S *Server) GetGroupsHandler(w http.ResponseWriter, r *http.Request) {
 			S.db.QueryRow("SELECT COUNT(*) FROM group_members WHERE group_id = ? AND user_id = ?", g.ID, userID).Scan(&count)
 			g.IsMember = count > 0
 			g.IsCreator = g.CreatorID == userID
+			if g.IsMember {
+				g.UnreadCount, _ = S.GetGroupUnreadCount(g.ID, userID)
+			}
 		}
 		groups = append(groups, g)
 	}
@@ -209,6 +212,12 @@ func (S *Server) DeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	S.RemoveAttachments("group_message_id IN (SELECT id FROM group_messages WHERE group_id = ?)", groupID)
+	if _, err := S.db.Exec(`
+		DELETE FROM mentions WHERE source = 'group_message' AND source_id IN (SELECT id FROM group_messages WHERE group_id = ?)
+	`, groupID); err != nil {
+		fmt.Println("Error deleting group mentions:", err)
+	}
 	_, err = S.db.Exec("DELETE FROM groups WHERE id = ?", groupID)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -317,6 +326,11 @@ func (S *Server) InviteGroupMemberHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if blocked, err := S.IsBlocked(userID, req.UserID); err != nil || blocked {
+		http.Error(w, "Cannot invite this user", http.StatusForbidden)
+		return
+	}
+
 	// Check if invited user is already member
 	S.db.QueryRow("SELECT COUNT(*) FROM group_members WHERE group_id = ? AND user_id = ?", req.GroupID, req.UserID).Scan(&count)
 	if count > 0 {
@@ -604,6 +618,11 @@ func (S *Server) CreateGroupPostHandler(w http.ResponseWriter, r *http.Request)
 	post.UserID = userID
 	post.CreatedAt = time.Now().Format(time.RFC3339)
 
+	if err := IndexPostHashtags(S.db, post.ID, post.Content); err != nil {
+		fmt.Println("Error indexing hashtags:", err)
+	}
+	S.UpdateMentions("post", post.ID, userID, post.Content)
+
 	// Fetch full post details
 	fullPost, err := S.GetPostFromID(post.ID, userID)
 	if err != nil {
@@ -640,16 +659,27 @@ func (S *Server) GetGroupPostsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, err := ParsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	notBlocked, notBlockedArgs := NotBlockedCondition("p.user_id", userID)
+	condition, conditionArgs := page.Condition("p.created_at", "p.id")
+	args := append([]interface{}{groupID}, notBlockedArgs...)
+	args = append(append(args, conditionArgs...), page.Limit+1)
 	rows, err := S.db.Query(`
 	SELECT 
-		p.id, p.content, p.image, p.created_at, p.privacy,
+		p.id, p.content, p.image, p.created_at, p.edited_at, p.privacy,
 		u.id, u.first_name, u.last_name, u.nickname, u.avatar, u.is_private,
 		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) as comment_count
 	FROM posts p
 	JOIN users u ON p.user_id = u.id
-	WHERE p.group_id = ?
-	ORDER BY p.created_at DESC
-`, groupID)
+	WHERE p.group_id = ? AND `+notBlocked+` AND `+NotSuspendedCondition("p.user_id")+` AND `+condition+`
+	ORDER BY `+page.OrderBy("p.created_at", "p.id", true)+`
+	LIMIT ?
+`, args...)
 
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -661,10 +691,10 @@ func (S *Server) GetGroupPostsHandler(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var post Post
 		var authorID int
-		var firstName, lastName, nickname, avatar sql.NullString
+		var firstName, lastName, nickname, avatar, editedAt sql.NullString
 		var isPrivate bool
 		if err := rows.Scan(
-			&post.ID, &post.Content, &post.Image, &post.CreatedAt, &post.Privacy,
+			&post.ID, &post.Content, &post.Image, &post.CreatedAt, &editedAt, &post.Privacy,
 			&authorID, &firstName, &lastName, &nickname, &avatar, &isPrivate,
 			&post.Comments,
 		); err != nil {
@@ -678,11 +708,24 @@ func (S *Server) GetGroupPostsHandler(w http.ResponseWriter, r *http.Request) {
 			IsPrivate: isPrivate,
 		}
 		post.UserID = authorID
+		post.EditedAt = editedAt.String
 		posts = append(posts, post)
 	}
 
+	posts, nextCursor := FinishPage(page, posts, true, func(post Post) string {
+		return EncodeCursor(post.ID, post.CreatedAt)
+	})
+	if err := S.LoadPostsReactions(posts, userID); err != nil {
+		fmt.Println("Error loading reactions:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(posts)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"posts":      posts,
+		"nextCursor": nextCursor,
+	})
 }
 
 // CreateGroupEventHandler creates an event
@@ -859,47 +902,110 @@ func (S *Server) GetGroupChatHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := S.db.Query(`
-		SELECT m.id, m.group_id, m.sender_id, m.content, m.created_at,
-		       u.first_name, u.last_name, u.nickname, u.avatar
-		FROM group_messages m
-		JOIN users u ON m.sender_id = u.id
-		WHERE m.group_id = ?
-		ORDER BY m.created_at ASC
-	`, groupID)
+	page, err := ParsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// ?around={messageID} opens the history at a given message
+	var around *Cursor
+	if aroundID := r.URL.Query().Get("around"); aroundID != "" {
+		checkAround, messageID := tools.IsNumeric(aroundID)
+		if !checkAround || page.Before != nil || page.After != nil {
+			http.Error(w, "Invalid around message", http.StatusBadRequest)
+			return
+		}
+		stored, err := S.getStoredGroupMessage(messageID)
+		if err != nil || stored.ChatID != groupID {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		around = NewCursor(messageID, stored.CreatedAt.UTC().Format(sqliteTimeLayout))
+	}
 
+	messages, nextCursor, newerCursor, err := ChatWindow(page, around, func(p Page) ([]map[string]interface{}, string, error) {
+		return S.GetGroupMessages(groupID, userID, p)
+	}, groupMessageCursor)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages":    messages,
+		"nextCursor":  nextCursor,
+		"newerCursor": newerCursor,
+	})
+}
+
+func groupMessageCursor(message map[string]interface{}) string {
+	return EncodeCursor(message["id"].(int), message["createdAt"].(string))
+}
+
+// GetGroupMessages returns one page of a group chat newest first, and the cursor of the following page
+func (S *Server) GetGroupMessages(groupID, userID int, page Page) ([]map[string]interface{}, string, error) {
+	condition, conditionArgs := page.Condition("m.created_at", "m.id")
+	args := append([]interface{}{groupID, userID}, conditionArgs...)
+	args = append(args, page.Limit+1)
+	rows, err := S.db.Query(`
+		SELECT m.id, m.group_id, m.sender_id, m.content, m.type, m.created_at, m.is_deleted, m.edited_at,
+		       u.first_name, u.last_name, u.nickname, u.avatar,
+		       (SELECT COUNT(*) FROM group_chat_reads r
+		        WHERE r.group_id = m.group_id AND r.user_id != m.sender_id AND r.last_read_id >= m.id) AS read_by
+		FROM group_messages m
+		JOIN users u ON m.sender_id = u.id
+		WHERE m.group_id = ? AND NOT EXISTS (
+			SELECT 1 FROM hidden_group_messages h WHERE h.message_id = m.id AND h.user_id = ?)
+		AND `+condition+`
+		ORDER BY `+page.OrderBy("m.created_at", "m.id", true)+`
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, "", err
+	}
 	defer rows.Close()
 
 	var messages []map[string]interface{}
 	for rows.Next() {
-		var id, gid, sid int
-		var content, createdAt string
-		var fname, lname, nick, av sql.NullString
-		if err := rows.Scan(&id, &gid, &sid, &content, &createdAt, &fname, &lname, &nick, &av); err != nil {
+		var id, gid, sid, readBy int
+		var content, msgType, createdAt string
+		var isDeleted bool
+		var editedAt, fname, lname, nick, av sql.NullString
+		if err := rows.Scan(&id, &gid, &sid, &content, &msgType, &createdAt, &isDeleted, &editedAt, &fname, &lname, &nick, &av, &readBy); err != nil {
 			continue
 		}
-		messages = append(messages, map[string]interface{}{
-			"id":        id,
-			"groupId":   gid,
-			"senderId":  sid,
-			"content":   content,
-			"createdAt": createdAt,
+		message := map[string]interface{}{
+			"id":          id,
+			"groupId":     gid,
+			"senderId":    sid,
+			"content":     content,
+			"messageType": msgType,
+			"createdAt":   createdAt,
 			"sender": map[string]interface{}{
 				"firstName": fname.String,
 				"lastName":  lname.String,
 				"nickname":  nick.String,
 				"avatar":    av.String,
 			},
-			"isOwn": sid == userID,
-		})
+			"isOwn":  sid == userID,
+			"readBy": readBy,
+		}
+		if isDeleted {
+			message["isDeleted"] = true
+		}
+		if editedAt.Valid {
+			message["editedAt"] = editedAt.String
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(messages)
+	messages, nextCursor := FinishPage(page, messages, true, groupMessageCursor)
+	return messages, nextCursor, nil
 }
 
 // SendGroupMessageHandler sends a message to a group
@@ -916,71 +1022,127 @@ func (S *Server) SendGroupMessageHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	var msg struct {
-		GroupID int    `json:"groupId"`
-		Content string `json:"content"`
+		GroupID     int    `json:"groupId"`
+		Content     string `json:"content"`
+		MessageType string `json:"messageType"` // "text" (default), "emoji", "gif" or "image"
 	}
 	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	if strings.TrimSpace(msg.Content) == "" {
-		http.Error(w, "Content is required", http.StatusBadRequest)
+	messagePayload, err := S.SendGroupMessage(userID, sessionID, msg.GroupID, msg.MessageType, msg.Content)
+	if err != nil {
+		if actionErr, ok := err.(*ActionError); ok {
+			http.Error(w, actionErr.Message, actionErr.Status)
+			return
+		}
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(messagePayload)
+}
+
+// SendGroupMessage stores a group chat message and pushes it to every member.
+// sessionID is the sender's session, which already has the message.
+func (S *Server) SendGroupMessage(userID int, sessionID string, groupID int, msgType, content string) (map[string]interface{}, error) {
+	if err := S.CheckVerified(userID); err != nil {
+		return nil, err
+	}
+	if msgType == "" {
+		msgType = "text"
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, NewActionError(http.StatusBadRequest, "Content is required")
+	}
+	if !S.ValidateMessage(Message{Type: msgType, Content: content}) {
+		return nil, NewActionError(http.StatusBadRequest, "Invalid message data")
+	}
+
 	// Check membership
 	var count int
-	S.db.QueryRow("SELECT COUNT(*) FROM group_members WHERE group_id = ? AND user_id = ?", msg.GroupID, userID).Scan(&count)
+	S.db.QueryRow("SELECT COUNT(*) FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID).Scan(&count)
 	if count == 0 {
-		http.Error(w, "Not a member", http.StatusForbidden)
-		return
+		return nil, NewActionError(http.StatusForbidden, "Not a member")
+	}
+
+	if err := S.CheckMediaContent(userID, msgType, content); err != nil {
+		return nil, err
 	}
 
 	// Insert message
-	res, err := S.db.Exec("INSERT INTO group_messages (group_id, sender_id, content) VALUES (?, ?, ?)", msg.GroupID, userID, html.EscapeString(msg.Content))
+	res, err := S.db.Exec("INSERT INTO group_messages (group_id, sender_id, content, type) VALUES (?, ?, ?, ?)", groupID, userID, html.EscapeString(content), msgType)
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 	msgID, _ := res.LastInsertId()
+	if msgType == "image" || msgType == "gif" {
+		if err := S.LinkAttachment("group_message_id", int(msgID), content); err != nil {
+			fmt.Println("Link Attachment Error : ", err)
+		}
+	} else if msgType == "text" {
+		S.UpdateMentions("group_message", int(msgID), userID, content)
+	}
 
 	// Get sender info
 	var sender User
 	S.db.QueryRow("SELECT first_name, last_name, nickname, avatar FROM users WHERE id = ?", userID).Scan(&sender.FirstName, &sender.LastName, &sender.Nickname, &sender.AvatarUrl)
 
 	messagePayload := map[string]interface{}{
-		"id":        msgID,
-		"groupId":   msg.GroupID,
-		"senderId":  userID,
-		"content":   html.EscapeString(msg.Content),
-		"createdAt": time.Now().Format(time.RFC3339),
-		"sender":    sender,
-		"type":      "group_message",
+		"id":          msgID,
+		"groupId":     groupID,
+		"senderId":    userID,
+		"content":     html.EscapeString(content),
+		"createdAt":   time.Now().UTC().Format(time.RFC3339),
+		"sender":      sender,
+		"type":        "group_message",
+		"messageType": msgType,
 	}
 
 	// Broadcast to all members
-	rows, err := S.db.Query("SELECT user_id FROM group_members WHERE group_id = ?", msg.GroupID)
+	rows, err := S.db.Query("SELECT user_id FROM group_members WHERE group_id = ?", groupID)
 	if err != nil {
 		fmt.Println("Error getting group members for broadcast:", err)
-	} else {
-		defer rows.Close()
-		for rows.Next() {
-			var memberID int
-			if err := rows.Scan(&memberID); err != nil {
-				continue
-			}
+		return messagePayload, nil
+	}
+	var members []int
+	for rows.Next() {
+		var memberID int
+		if err := rows.Scan(&memberID); err != nil {
+			continue
+		}
+		members = append(members, memberID)
+	}
+	rows.Close()
 
-			sid := ""
-			if memberID == userID {
-				sid = sessionID
+	for _, memberID := range members {
+		sid := ""
+		if memberID == userID {
+			sid = sessionID
+		}
+		payload := messagePayload
+		if memberID != userID && S.IsMuted(memberID, userID, "chat") {
+			payload = map[string]interface{}{"muted": true}
+			for key, value := range messagePayload {
+				payload[key] = value
 			}
-			S.PushMessage(sid, memberID, messagePayload)
 		}
+		S.PushMessage(sid, memberID, payload)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(messagePayload)
+	return messagePayload, nil
+}
+
+// IsGroupMember reports whether userID belongs to groupID
+func (S *Server) IsGroupMember(groupID, userID int) (bool, error) {
+	var isMember bool
+	err := S.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ?)`, groupID, userID).Scan(&isMember)
+	if err != nil {
+		return false, err
+	}
+	return isMember, nil
 }
 
 func (S *Server) GetGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
@@ -1006,12 +1168,13 @@ func (S *Server) GetGroupMembersHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	notBlocked, notBlockedArgs := NotBlockedCondition("u.id", userID)
 	rows, err := S.db.Query(`
 		SELECT u.id, u.first_name, u.last_name, u.nickname, u.avatar, u.is_private, u.url
 		FROM group_members gm
 		JOIN users u ON gm.user_id = u.id
-		WHERE gm.group_id = ?
-	`, groupID)
+		WHERE gm.group_id = ? AND `+notBlocked+`
+	`, append([]interface{}{groupID}, notBlockedArgs...)...)
 
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
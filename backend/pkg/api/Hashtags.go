@@ -0,0 +1,262 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MaxHashtagLength is the longest tag that is indexed, longer ones are ignored
+const MaxHashtagLength = 50
+
+// MaxHashtagsPerText caps how many tags a single post or comment adds to the index
+const MaxHashtagsPerText = 20
+
+// TrendingSize is how many tags /api/trending returns
+const TrendingSize = 10
+
+// TrendingWindow is how far back tag usage counts towards trending.
+// Run overrides it with TRENDING_WINDOW (e.g. "6h") when set.
+var TrendingWindow = 24 * time.Hour
+
+// TrendingInterval is how often the trending job recomputes the scores.
+// Run overrides it with TRENDING_INTERVAL (e.g. "1m") when set.
+var TrendingInterval = 5 * time.Minute
+
+// a tag starts after a space or punctuation, so "a#b", "&#39;" and link fragments are not tags
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#/])#([\p{L}\p{N}_]+)`)
+
+// ParseHashtags returns the distinct hashtags of a text, lowercased and without the #.
+// Stored content is HTML-escaped, so it is unescaped first.
+func ParseHashtags(content string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, match := range hashtagPattern.FindAllStringSubmatch(html.UnescapeString(content), -1) {
+		tag, ok := NormalizeHashtag(match[1])
+		if !ok || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == MaxHashtagsPerText {
+			break
+		}
+	}
+	return tags
+}
+
+// NormalizeHashtag lowercases a tag and strips a leading #.
+// Tags are letters, digits and underscores, with at least one letter.
+func NormalizeHashtag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	if tag == "" || len([]rune(tag)) > MaxHashtagLength {
+		return "", false
+	}
+	hasLetter := false
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_' {
+			return "", false
+		}
+		hasLetter = hasLetter || unicode.IsLetter(r)
+	}
+	return tag, hasLetter
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// IndexPostHashtags replaces the tags indexed for a post with the ones in content.
+// Tags the post already had keep their original date.
+func IndexPostHashtags(db execer, postID int, content string) error {
+	return indexHashtags(db, "post_hashtags", "post_id", postID, ParseHashtags(content),
+		`INSERT OR IGNORE INTO post_hashtags (post_id, tag) VALUES (?, ?)`)
+}
+
+// IndexCommentHashtags replaces the tags indexed for a comment with the ones in content
+func IndexCommentHashtags(db execer, commentID, postID int, content string) error {
+	return indexHashtags(db, "comment_hashtags", "comment_id", commentID, ParseHashtags(content),
+		`INSERT OR IGNORE INTO comment_hashtags (comment_id, tag, post_id) VALUES (?, ?, ?)`, postID)
+}
+
+// indexHashtags removes the rows of table for id that are not in tags, then inserts tags
+// with insert, which takes id, the tag, then extra
+func indexHashtags(db execer, table, column string, id int, tags []string, insert string, extra ...interface{}) error {
+	query := `DELETE FROM ` + table + ` WHERE ` + column + ` = ?`
+	args := []interface{}{id}
+	if len(tags) > 0 {
+		query += ` AND tag NOT IN (?` + strings.Repeat(`, ?`, len(tags)-1) + `)`
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+	}
+	if _, err := db.Exec(query, args...); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if _, err := db.Exec(insert, append([]interface{}{id, tag}, extra...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HashtagFeedHandler returns the posts using a hashtag that the current user may see, newest first,
+// without the posts of muted accounts.
+// GET /api/hashtags/{tag}
+func (S *Server) HashtagFeedHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tag, ok := NormalizeHashtag(r.URL.Path[len("/api/hashtags/"):])
+	if !ok {
+		tools.SendJSONError(w, "invalid hashtag", http.StatusBadRequest)
+		return
+	}
+
+	page, err := ParsePage(r)
+	if err != nil {
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	notMuted, notMutedArgs := NotMutedCondition("posts", "p.user_id", currentUserID)
+	filter := `p.id IN (SELECT post_id FROM post_hashtags WHERE tag = ?) AND ` + notMuted
+	posts, nextCursor, err := S.QueryPosts(filter, append([]interface{}{tag}, notMutedArgs...), currentUserID, page)
+	if err != nil {
+		fmt.Println("HashtagFeedHandler error : ", err)
+		tools.SendJSONError(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tag":        tag,
+		"posts":      posts,
+		"nextCursor": nextCursor,
+	})
+}
+
+// TrendingHandler returns the tags computed by the last run of the trending job
+func (S *Server) TrendingHandler(w http.ResponseWriter, r *http.Request) {
+	banned, _ := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	S.trendingMu.RLock()
+	trending := S.trending
+	S.trendingMu.RUnlock()
+	if trending.Tags == nil {
+		// the job has not run yet
+		trending = Trending{Tags: []TrendingTag{}, Window: TrendingWindow.String()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trending)
+}
+
+// RunTrendingJob recomputes the trending tags now and then every interval. It never returns.
+func (S *Server) RunTrendingJob(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := S.RefreshTrending(); err != nil {
+			fmt.Println("Trending Job Error : ", err)
+		}
+		<-ticker.C
+	}
+}
+
+// RefreshTrending scores the tags used within TrendingWindow and keeps the top TrendingSize.
+// Only public posts and the comments on them count, since the result is shown to everyone.
+// Each author counts once per tag, weighted by how recent their latest use is,
+// so one account repeating a tag cannot make it trend. Suspended accounts do not count.
+func (S *Server) RefreshTrending() error {
+	since := fmt.Sprintf("-%d seconds", int(TrendingWindow.Seconds()))
+	rows, err := S.db.Query(`
+		WITH uses(tag, user_id, created_at) AS (
+			SELECT ph.tag, p.user_id, ph.created_at
+			FROM post_hashtags ph
+			JOIN posts p ON p.id = ph.post_id
+			WHERE ph.created_at >= datetime('now', ?) AND p.group_id IS NULL AND p.privacy = 'public'
+			UNION ALL
+			SELECT ch.tag, c.user_id, ch.created_at
+			FROM comment_hashtags ch
+			JOIN comments c ON c.id = ch.comment_id
+			JOIN posts p ON p.id = ch.post_id
+			WHERE ch.created_at >= datetime('now', ?) AND p.group_id IS NULL AND p.privacy = 'public'
+		)
+		SELECT tag, COUNT(*), (julianday('now') - julianday(MAX(created_at))) * 86400
+		FROM uses
+		WHERE `+NotSuspendedCondition("uses.user_id")+`
+		GROUP BY tag, user_id
+	`, since, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byTag := map[string]*TrendingTag{}
+	for rows.Next() {
+		var tag string
+		var uses int
+		var age float64
+		if err := rows.Scan(&tag, &uses, &age); err != nil {
+			return err
+		}
+		trend, ok := byTag[tag]
+		if !ok {
+			trend = &TrendingTag{Tag: tag}
+			byTag[tag] = trend
+		}
+		trend.Uses += uses
+		trend.Users++
+		trend.Score += math.Max(0, 1-age/TrendingWindow.Seconds())
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tags := make([]TrendingTag, 0, len(byTag))
+	for _, trend := range byTag {
+		trend.Score = math.Round(trend.Score*100) / 100
+		tags = append(tags, *trend)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Score != tags[j].Score {
+			return tags[i].Score > tags[j].Score
+		}
+		if tags[i].Uses != tags[j].Uses {
+			return tags[i].Uses > tags[j].Uses
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	if len(tags) > TrendingSize {
+		tags = tags[:TrendingSize]
+	}
+
+	S.trendingMu.Lock()
+	S.trending = Trending{
+		Tags:       tags,
+		Window:     TrendingWindow.String(),
+		ComputedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	S.trendingMu.Unlock()
+	return nil
+}
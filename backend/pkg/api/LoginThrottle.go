@@ -0,0 +1,174 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// how many failed logins are allowed before a lockout: per account (or unknown identifier),
+// and per IP address, which covers guessing across many accounts
+const (
+	LoginFreeAttempts   = 5
+	LoginIPFreeAttempts = 20
+)
+
+// LoginLockout is the first lockout; each further failure doubles it up to LoginMaxLockout.
+// Failures are forgotten after LoginFailureWindow without any, or on a successful login.
+var (
+	LoginLockout       = time.Minute
+	LoginMaxLockout    = time.Hour
+	LoginFailureWindow = 24 * time.Hour
+)
+
+// dummyPasswordHash is compared against when the identifier matches no account, so a login
+// takes as long whether or not the user exists
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// loginThrottleKeys returns the keys a login attempt counts against: the account, and the
+// client's address
+func loginThrottleKeys(r *http.Request, userID int, identifier string) (string, string) {
+	accountKey := "login:" + identifier
+	if userID != 0 {
+		accountKey = "user:" + strconv.Itoa(userID)
+	}
+	return accountKey, "ip:" + clientIP(r)
+}
+
+// LoginLockedUntil returns the latest lockout end among keys, or the zero time when none is locked
+func (S *Server) LoginLockedUntil(keys ...string) (time.Time, error) {
+	var until time.Time
+	for _, key := range keys {
+		var lockedUntil sql.NullTime
+		err := S.db.QueryRow(`
+			SELECT locked_until FROM login_throttles
+			WHERE key = ? AND locked_until > ?
+		`, key, time.Now().UTC().Format("2006-01-02 15:04:05")).Scan(&lockedUntil)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if lockedUntil.Valid && lockedUntil.Time.After(until) {
+			until = lockedUntil.Time
+		}
+	}
+	return until, nil
+}
+
+// LoginLockedError is returned by checks made during a lockout; SendActionError answers it
+// like SendLoginLocked
+type LoginLockedError struct {
+	Until time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	return "too many failed attempts, try again later"
+}
+
+// CheckLoginLocked returns a *LoginLockedError while any of keys is locked out
+func (S *Server) CheckLoginLocked(keys ...string) error {
+	lockedUntil, err := S.LoginLockedUntil(keys...)
+	if err != nil {
+		return err
+	}
+	if !lockedUntil.IsZero() {
+		return &LoginLockedError{Until: lockedUntil}
+	}
+	return nil
+}
+
+// RecordLoginFailure counts a failed attempt against key. From the freeAttempts-th failure on,
+// key is locked out and the returned time is when the lockout ends.
+func (S *Server) RecordLoginFailure(key string, freeAttempts int) (time.Time, error) {
+	now := time.Now().UTC()
+	tx, err := S.db.Begin()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	var failures int
+	var lastFailure sql.NullTime
+	err = tx.QueryRow(`SELECT failures, last_failure_at FROM login_throttles WHERE key = ?`, key).Scan(&failures, &lastFailure)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+	if lastFailure.Valid && now.Sub(lastFailure.Time) > LoginFailureWindow {
+		failures = 0
+	}
+	failures++
+
+	var lockedUntil time.Time
+	var lockedUntilValue interface{}
+	if failures >= freeAttempts {
+		lockedUntil = now.Add(doubledCapped(LoginLockout, LoginMaxLockout, failures-freeAttempts))
+		lockedUntilValue = lockedUntil.Format("2006-01-02 15:04:05")
+	}
+	_, err = tx.Exec(`
+		INSERT INTO login_throttles (key, failures, last_failure_at, locked_until)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			failures = excluded.failures,
+			last_failure_at = excluded.last_failure_at,
+			locked_until = excluded.locked_until
+	`, key, failures, now.Format("2006-01-02 15:04:05"), lockedUntilValue)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lockedUntil, tx.Commit()
+}
+
+// ClearLoginFailures forgets the failed attempts of key
+func (S *Server) ClearLoginFailures(key string) {
+	if _, err := S.db.Exec(`DELETE FROM login_throttles WHERE key = ?`, key); err != nil {
+		fmt.Println("Clear Login Failures Error : ", err)
+	}
+}
+
+// LoginFailed records a failed password or code for the account behind accountKey and for the
+// client's address. userID is 0 when the identifier matched no account; otherwise the failure,
+// and a lockout it starts, go to the user's security log.
+func (S *Server) LoginFailed(r *http.Request, userID int, accountKey, ipKey, event string) {
+	if userID != 0 {
+		S.LogSecurityEvent(r, userID, event, "")
+	}
+	lockedUntil, err := S.RecordLoginFailure(accountKey, LoginFreeAttempts)
+	if err != nil {
+		fmt.Println("Record Login Failure Error : ", err)
+	} else if !lockedUntil.IsZero() && userID != 0 {
+		S.LogSecurityEvent(r, userID, SecurityLoginLocked, "")
+	}
+	if _, err := S.RecordLoginFailure(ipKey, LoginIPFreeAttempts); err != nil {
+		fmt.Println("Record Login Failure Error : ", err)
+	}
+}
+
+// SendLoginLocked answers a login attempt made during a lockout
+func SendLoginLocked(w http.ResponseWriter, until time.Time) {
+	seconds := int(math.Ceil(time.Until(until).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	tools.SendJSONError(w, "too many failed attempts, try again later", http.StatusTooManyRequests)
+}
+
+// doubledCapped is base doubled n times, capped at max
+func doubledCapped(base, max time.Duration, n int) time.Duration {
+	d := base
+	for i := 0; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer delivers a plain text email
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer sends mail through an SMTP server, authenticating when Username is set
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	msg := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{to}, []byte(msg))
+}
+
+// LogMailerStdout as a LogMailer Path prints whole mails, links included, to stdout
+const LogMailerStdout = "stdout"
+
+// LogMailer writes mail to the file at Path, or to stdout when Path is LogMailerStdout,
+// for local development and tests. With no Path only the recipient and subject are printed,
+// since bodies carry reset and verification links.
+type LogMailer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	if m.Path == "" {
+		fmt.Printf("Mail to %s : %s (not delivered, set SMTP_HOST or MAIL_LOG)\n", to, subject)
+		return nil
+	}
+	entry := fmt.Sprintf("To: %s\nSubject: %s\nDate: %s\n\n%s\n----\n", to, subject, time.Now().Format(time.RFC3339), body)
+	if m.Path == LogMailerStdout {
+		fmt.Print(entry)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(entry)
+	return err
+}
+
+// MailerFromEnv returns an SMTPMailer when SMTP_HOST is set, otherwise a LogMailer
+// writing to MAIL_LOG, a file path or "stdout"
+func MailerFromEnv() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return &LogMailer{Path: os.Getenv("MAIL_LOG")}
+	}
+	mailer := SMTPMailer{
+		Host:     host,
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}
+	if mailer.Port == "" {
+		mailer.Port = "587"
+	}
+	if mailer.From == "" {
+		mailer.From = "no-reply@" + host
+	}
+	return mailer
+}
+
+// SendMail delivers an email in the background so handlers do not wait on the mail server,
+// and so response times do not tell whether an address is registered
+func (S *Server) SendMail(to, subject, body string) {
+	mailer := S.Mailer
+	if mailer == nil {
+		mailer = &LogMailer{}
+	}
+	go func() {
+		if err := mailer.Send(to, subject, body); err != nil {
+			fmt.Println("Send Mail Error : ", err)
+		}
+	}()
+}
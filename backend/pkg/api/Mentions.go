@@ -0,0 +1,226 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MaxMentionsPerText caps how many users a single post, comment or message can mention
+const MaxMentionsPerText = 10
+
+// MentionSuggestions is how many users /api/mentions/suggest returns
+const MentionSuggestions = 10
+
+// a mention starts after a space or punctuation, so e-mail addresses are not mentions
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@/])@([\p{L}\p{N}_.\-]+)`)
+
+// ParseMentions returns the distinct @handles of a text, lowercased and without the @
+func ParseMentions(content string) []string {
+	var handles []string
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(html.UnescapeString(content), -1) {
+		// "@bob." at the end of a sentence mentions bob
+		handle := strings.ToLower(strings.TrimRight(match[1], ".-"))
+		if handle == "" || seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		handles = append(handles, handle)
+		if len(handles) == MaxMentionsPerText {
+			break
+		}
+	}
+	return handles
+}
+
+// ResolveMentions returns the ids of the users whose url or nickname is one of handles
+func (S *Server) ResolveMentions(handles []string) ([]int, error) {
+	if len(handles) == 0 {
+		return nil, nil
+	}
+	placeholders := `?` + strings.Repeat(`, ?`, len(handles)-1)
+	args := make([]interface{}, 0, 2*len(handles))
+	for _, handle := range handles {
+		args = append(args, html.EscapeString(handle))
+	}
+	args = append(args, args...)
+
+	rows, err := S.db.Query(`
+		SELECT id FROM users WHERE lower(url) IN (`+placeholders+`) OR lower(nickname) IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// UpdateMentions syncs the mentions stored for a post, comment or group message (source)
+// with its current content, and sends a notification to each newly mentioned user.
+// Users who cannot see the content or are blocked are neither stored nor notified, so an edit that
+// widens the audience notifies the users who can see it now.
+// An empty content removes every mention of the source.
+func (S *Server) UpdateMentions(source string, sourceID, actorID int, content string) {
+	notification := Notification{ActorID: actorID, Type: "mention", CreatedAt: time.Now()}
+	var canSee func(userID int) (bool, error)
+
+	switch source {
+	case "post":
+		notification.Content = "Mentioned you in a post"
+		notification.ReferenceID = sourceID
+		canSee = func(userID int) (bool, error) {
+			return S.CheckPostPrivacy(sourceID, actorID, userID, "")
+		}
+	case "comment":
+		notification.Content = "Mentioned you in a comment"
+		if err := S.db.QueryRow(`SELECT post_id FROM comments WHERE id = ?`, sourceID).Scan(&notification.ReferenceID); err != nil {
+			fmt.Println("Update Mentions Error : ", err)
+			return
+		}
+		canSee = func(userID int) (bool, error) {
+			return S.CheckPostPrivacy(notification.ReferenceID, 0, userID, "")
+		}
+	case "group_message":
+		// the reference is the group, so deleting a post never removes these
+		notification.Type = "group_mention"
+		notification.Content = "Mentioned you in the group chat"
+		if err := S.db.QueryRow(`SELECT group_id FROM group_messages WHERE id = ?`, sourceID).Scan(&notification.ReferenceID); err != nil {
+			fmt.Println("Update Mentions Error : ", err)
+			return
+		}
+		canSee = func(userID int) (bool, error) {
+			return S.IsGroupMember(notification.ReferenceID, userID)
+		}
+	default:
+		fmt.Println("Update Mentions Error : unknown source", source)
+		return
+	}
+
+	mentioned, err := S.ResolveMentions(ParseMentions(content))
+	if err != nil {
+		fmt.Println("Update Mentions Error : ", err)
+		return
+	}
+
+	var keep []int
+	for _, userID := range mentioned {
+		if userID == actorID {
+			continue
+		}
+		if blocked, err := S.IsBlocked(actorID, userID); err != nil || blocked {
+			continue
+		}
+		if allowed, err := canSee(userID); err != nil || !allowed {
+			continue
+		}
+		keep = append(keep, userID)
+	}
+
+	query := `DELETE FROM mentions WHERE source = ? AND source_id = ?`
+	args := []interface{}{source, sourceID}
+	if len(keep) > 0 {
+		query += ` AND user_id NOT IN (?` + strings.Repeat(`, ?`, len(keep)-1) + `)`
+		for _, userID := range keep {
+			args = append(args, userID)
+		}
+	}
+	if _, err := S.db.Exec(query, args...); err != nil {
+		fmt.Println("Update Mentions Error : ", err)
+		return
+	}
+
+	for _, userID := range keep {
+		res, err := S.db.Exec(`
+			INSERT OR IGNORE INTO mentions (source, source_id, user_id, actor_id) VALUES (?, ?, ?, ?)
+		`, source, sourceID, userID, actorID)
+		if err != nil {
+			fmt.Println("Update Mentions Error : ", err)
+			continue
+		}
+		// already mentioned before this edit
+		if added, _ := res.RowsAffected(); added == 0 {
+			continue
+		}
+
+		notification.ID = userID
+		if err := S.InsertNotification(notification); err != nil {
+			fmt.Println("Error inserting notification:", err)
+			continue
+		}
+		S.PushNotification("-new", userID, notification)
+	}
+}
+
+// MentionSuggestHandler autocompletes @mentions: users whose handle or name starts with ?q=,
+// the accounts the current user follows first, then the members of their groups.
+// An empty q lists those people.
+func (S *Server) MentionSuggestHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("q")), "@"))
+	if len(q) > 50 {
+		tools.SendJSONError(w, "query is too long", http.StatusBadRequest)
+		return
+	}
+	// LIKE wildcards typed by the user are matched literally
+	prefix := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(html.EscapeString(q)) + `%`
+
+	notBlocked, notBlockedArgs := NotBlockedCondition("u.id", currentUserID)
+	args := []interface{}{currentUserID, currentUserID, currentUserID}
+	args = append(args, notBlockedArgs...)
+	args = append(args, prefix, prefix, prefix, prefix, q, MentionSuggestions)
+	rows, err := S.db.Query(`
+		SELECT u.id, u.first_name || ' ' || u.last_name, COALESCE(u.nickname, ''), COALESCE(u.avatar, ''), u.url,
+			EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = ? AND f.following_id = u.id) AS following,
+			EXISTS (
+				SELECT 1 FROM group_members mine
+				JOIN group_members theirs ON theirs.group_id = mine.group_id
+				WHERE mine.user_id = ? AND theirs.user_id = u.id
+			) AS group_member
+		FROM users u
+		WHERE u.id != ? AND `+notBlocked+` AND (
+			lower(u.url) LIKE ? ESCAPE '\' OR lower(u.nickname) LIKE ? ESCAPE '\'
+			OR lower(u.first_name) LIKE ? ESCAPE '\' OR lower(u.last_name) LIKE ? ESCAPE '\')
+		ORDER BY following DESC, group_member DESC, lower(u.url) = ? DESC, u.url
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		fmt.Println("Mention Suggest Error : ", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	suggestions := []MentionSuggestion{}
+	for rows.Next() {
+		var s MentionSuggestion
+		if err := rows.Scan(&s.ID, &s.Name, &s.Username, &s.Avatar, &s.Url, &s.Following, &s.GroupMember); err != nil {
+			fmt.Println("Mention Suggest Error : ", err)
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
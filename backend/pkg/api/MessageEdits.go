@@ -0,0 +1,386 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MessageEditWindow is how long after sending a message its sender can still edit it.
+// Run overrides it with MESSAGE_EDIT_WINDOW (e.g. "30m") when set.
+var MessageEditWindow = 15 * time.Minute
+
+// storedMessage is what edit and delete checks need to know about a direct or group message
+type storedMessage struct {
+	BackendID int
+	ChatID    int // chat_id, or group_id for group messages
+	SenderID  int
+	Type      string
+	CreatedAt time.Time
+	IsDeleted bool
+}
+
+// EditMessageHandler lets the sender change the text of a direct message within MessageEditWindow
+func (S *Server) EditMessageHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPut, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		ID      string `json:"id"`
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := S.getStoredMessage(body.ID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if stored.SenderID != currentUserID {
+		S.RecordStrike(r, currentUserID, "editing another user's message")
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := checkEditable(stored, body.Content); err != nil {
+		SendActionError(w, err)
+		return
+	}
+
+	_, err = S.db.Exec(`UPDATE messages SET content = ?, edited_at = CURRENT_TIMESTAMP WHERE backend_id = ?`,
+		html.EscapeString(body.Content), stored.BackendID)
+	if err != nil {
+		tools.SendJSONError(w, "Failed to edit message", http.StatusInternalServerError)
+		return
+	}
+
+	message := S.GetMessageContent(body.ID)
+	message.ChatID = stored.ChatID
+	message.SenderID = currentUserID
+	message.EditedAt = time.Now().UTC().Format(time.RFC3339)
+
+	participants, _ := S.GetChatParticipantIDs(stored.ChatID)
+	for _, userID := range participants {
+		message.IsOwn = userID == currentUserID
+		S.PushMessageOn("chat-edit", "", userID, message)
+	}
+
+	message.IsOwn = true
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message)
+}
+
+// UnsendMessageHandler deletes a direct message for both members. The row stays as a tombstone.
+// It answers with the chat's new latest message so the chat list can update its preview.
+func (S *Server) UnsendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := r.URL.Path[len("/api/unsend-message/"):]
+	stored, err := S.getStoredMessage(messageID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if stored.SenderID != currentUserID {
+		S.RecordStrike(r, currentUserID, "unsending another user's message")
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if stored.IsDeleted {
+		tools.SendJSONError(w, "Message already deleted", http.StatusBadRequest)
+		return
+	}
+
+	_, err = S.db.Exec(`UPDATE messages SET is_deleted = 1, content = '' WHERE backend_id = ?`, stored.BackendID)
+	if err != nil {
+		tools.SendJSONError(w, "Failed to unsend message", http.StatusInternalServerError)
+		return
+	}
+	S.RemoveAttachments("message_id = ?", stored.BackendID)
+
+	participants, _ := S.GetChatParticipantIDs(stored.ChatID)
+	for _, userID := range participants {
+		S.pushMessageDeleted(userID, stored.ChatID, messageID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(S.LastVisibleMessage(stored.ChatID, currentUserID))
+}
+
+// DeleteMessageForMeHandler hides a direct message for the current user only
+func (S *Server) DeleteMessageForMeHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodDelete, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := r.URL.Path[len("/api/delete-message/"):]
+	stored, err := S.getStoredMessage(messageID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if !S.CheckIfCaneSendMessage(currentUserID, stored.ChatID) {
+		tools.SendJSONError(w, "You are not a member of this chat", http.StatusForbidden)
+		return
+	}
+
+	_, err = S.db.Exec(`INSERT OR IGNORE INTO hidden_messages (message_id, user_id) VALUES (?, ?)`, stored.BackendID, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Failed to delete message", http.StatusInternalServerError)
+		return
+	}
+
+	S.pushMessageDeleted(currentUserID, stored.ChatID, messageID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(S.LastVisibleMessage(stored.ChatID, currentUserID))
+}
+
+// pushMessageDeleted tells every session of userID that a message left its view of the chat
+func (S *Server) pushMessageDeleted(userID, chatID int, messageID string) {
+	S.PushMessageOn("chat-delete", "", userID, map[string]interface{}{
+		"chat_id":        chatID,
+		"old_message_id": messageID,
+		"new_message":    S.LastVisibleMessage(chatID, userID),
+	})
+}
+
+func (S *Server) getStoredMessage(messageID string) (storedMessage, error) {
+	var stored storedMessage
+	err := S.db.QueryRow(`
+		SELECT backend_id, chat_id, sender_id, type, created_at, is_deleted FROM messages WHERE id = ?
+	`, messageID).Scan(&stored.BackendID, &stored.ChatID, &stored.SenderID, &stored.Type, &stored.CreatedAt, &stored.IsDeleted)
+	if err == sql.ErrNoRows {
+		return stored, NewActionError(http.StatusNotFound, "Message not found")
+	}
+	return stored, err
+}
+
+// checkEditable reports why a message cannot be given new content, if it cannot
+func checkEditable(stored storedMessage, content string) error {
+	if stored.IsDeleted {
+		return NewActionError(http.StatusBadRequest, "Message was deleted")
+	}
+	if stored.Type != "text" {
+		return NewActionError(http.StatusBadRequest, "Only text messages can be edited")
+	}
+	if strings.TrimSpace(content) == "" {
+		return NewActionError(http.StatusBadRequest, "Content cannot be empty")
+	}
+	if time.Since(stored.CreatedAt) > MessageEditWindow {
+		return NewActionError(http.StatusForbidden, "Message can no longer be edited")
+	}
+	return nil
+}
+
+// LastVisibleMessage returns the latest message of a chat that userID has not deleted for themselves.
+// Tombstones count, with empty content.
+func (S *Server) LastVisibleMessage(chatID, userID int) Message {
+	message := Message{ChatID: chatID}
+	var createdAt sql.NullString
+	S.db.QueryRow(`
+		SELECT m.id, m.sender_id, m.content, m.type, m.is_deleted, m.created_at FROM messages m
+		WHERE m.chat_id = ? AND NOT EXISTS (
+			SELECT 1 FROM hidden_messages h WHERE h.message_id = m.backend_id AND h.user_id = ?)
+		ORDER BY m.backend_id DESC LIMIT 1
+	`, chatID, userID).Scan(&message.ID, &message.SenderID, &message.Content, &message.Type, &message.IsDeleted, &createdAt)
+	message.Timestamp = createdAt.String
+	message.IsOwn = message.SenderID == userID
+	return message
+}
+
+// EditGroupMessageHandler lets the sender change the text of a group message within MessageEditWindow
+func (S *Server) EditGroupMessageHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPut, true, false)
+	if banned {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := S.getStoredGroupMessage(body.ID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if stored.SenderID != currentUserID {
+		S.RecordStrike(r, currentUserID, "editing another user's group message")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := checkEditable(stored, body.Content); err != nil {
+		SendActionError(w, err)
+		return
+	}
+
+	content := html.EscapeString(body.Content)
+	_, err = S.db.Exec(`UPDATE group_messages SET content = ?, edited_at = CURRENT_TIMESTAMP WHERE id = ?`, content, body.ID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	S.UpdateMentions("group_message", body.ID, currentUserID, body.Content)
+
+	payload := map[string]interface{}{
+		"id":       body.ID,
+		"groupId":  stored.ChatID,
+		"senderId": currentUserID,
+		"content":  content,
+		"editedAt": time.Now().UTC().Format(time.RFC3339),
+		"type":     "group_message",
+	}
+	S.pushToGroupMembers("chat-edit", stored.ChatID, payload)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payload)
+}
+
+// UnsendGroupMessageHandler deletes a group message for every member, leaving a tombstone
+func (S *Server) UnsendGroupMessageHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	checkMessageID, messageID := tools.IsNumeric(r.URL.Path[len("/api/groups/chat/unsend/"):])
+	if !checkMessageID {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := S.getStoredGroupMessage(messageID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	if stored.SenderID != currentUserID {
+		S.RecordStrike(r, currentUserID, "unsending another user's group message")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if stored.IsDeleted {
+		http.Error(w, "Message already deleted", http.StatusBadRequest)
+		return
+	}
+
+	_, err = S.db.Exec(`UPDATE group_messages SET is_deleted = 1, content = '' WHERE id = ?`, messageID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	S.RemoveAttachments("group_message_id = ?", messageID)
+	S.UpdateMentions("group_message", messageID, currentUserID, "")
+
+	payload := map[string]interface{}{
+		"groupId":        stored.ChatID,
+		"old_message_id": messageID,
+		"type":           "group_message",
+	}
+	S.pushToGroupMembers("chat-delete", stored.ChatID, payload)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payload)
+}
+
+// DeleteGroupMessageForMeHandler hides a group message for the current user only
+func (S *Server) DeleteGroupMessageForMeHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodDelete, true, false)
+	if banned {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	checkMessageID, messageID := tools.IsNumeric(r.URL.Path[len("/api/groups/chat/delete/"):])
+	if !checkMessageID {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := S.getStoredGroupMessage(messageID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+	member, err := S.IsGroupMember(stored.ChatID, currentUserID)
+	if err != nil || !member {
+		http.Error(w, "Not a member", http.StatusForbidden)
+		return
+	}
+
+	_, err = S.db.Exec(`INSERT OR IGNORE INTO hidden_group_messages (message_id, user_id) VALUES (?, ?)`, messageID, currentUserID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	payload := map[string]interface{}{
+		"groupId":        stored.ChatID,
+		"old_message_id": messageID,
+		"type":           "group_message",
+	}
+	S.PushMessageOn("chat-delete", "", currentUserID, payload)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payload)
+}
+
+func (S *Server) getStoredGroupMessage(messageID int) (storedMessage, error) {
+	stored := storedMessage{BackendID: messageID, Type: "text"}
+	var msgType sql.NullString
+	err := S.db.QueryRow(`
+		SELECT group_id, sender_id, type, created_at, is_deleted FROM group_messages WHERE id = ?
+	`, messageID).Scan(&stored.ChatID, &stored.SenderID, &msgType, &stored.CreatedAt, &stored.IsDeleted)
+	if err == sql.ErrNoRows {
+		return stored, NewActionError(http.StatusNotFound, "Message not found")
+	}
+	if msgType.Valid {
+		stored.Type = msgType.String
+	}
+	return stored, err
+}
+
+// pushToGroupMembers sends a chat event to every session of every member of a group
+func (S *Server) pushToGroupMembers(channel string, groupID int, payload interface{}) {
+	rows, err := S.db.Query(`SELECT user_id FROM group_members WHERE group_id = ?`, groupID)
+	if err != nil {
+		fmt.Println("Error getting group members for broadcast:", err)
+		return
+	}
+	var members []int
+	for rows.Next() {
+		var memberID int
+		if err := rows.Scan(&memberID); err == nil {
+			members = append(members, memberID)
+		}
+	}
+	rows.Close()
+
+	for _, memberID := range members {
+		S.PushMessageOn(channel, "", memberID, payload)
+	}
+}
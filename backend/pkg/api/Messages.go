@@ -8,6 +8,7 @@ import (
 	"html"
 	"net/http"
 	"strings"
+	"time"
 )
 
 func (S *Server) GetUsersHandler(w http.ResponseWriter, r *http.Request) {
@@ -47,9 +48,7 @@ func (S *Server) MakeChatHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	follower, _ := S.IsFollower(currentUserID, "", otherUserID)
-	following, _ := S.IsFollowing(currentUserID, "", otherUserID)
-	if !follower && !following {
+	if !S.CanChatWith(currentUserID, otherUserID) {
 		tools.SendJSONError(w, "You can only create chats with your followers or followings", http.StatusForbidden)
 		return
 	}
@@ -68,9 +67,26 @@ func (S *Server) MakeChatHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(chatID)
 }
 
+// CanChatWith reports whether currentUserID may start a chat with otherUserID or add them to one:
+// one of them must follow the other and neither may have blocked the other
+func (S *Server) CanChatWith(currentUserID, otherUserID int) bool {
+	if blocked, err := S.IsBlocked(currentUserID, otherUserID); err != nil || blocked {
+		return false
+	}
+	follower, _ := S.IsFollower(currentUserID, "", otherUserID)
+	following, _ := S.IsFollowing(currentUserID, "", otherUserID)
+	return follower || following
+}
+
 func (S *Server) MakeChat(currentUserID, otherUserID int) (int, error) {
-	query := `INSERT INTO chats (user1_id, user2_id) VALUES (?, ?)`
-	result, err := S.db.Exec(query, currentUserID, otherUserID)
+	tx, err := S.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO chats (user1_id, user2_id, created_by) VALUES (?, ?, ?)`
+	result, err := tx.Exec(query, currentUserID, otherUserID, currentUserID)
 	if err != nil {
 		return 0, err
 	}
@@ -78,11 +94,15 @@ func (S *Server) MakeChat(currentUserID, otherUserID int) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return int(ID), nil
+	_, err = tx.Exec(`INSERT INTO chat_participants (chat_id, user_id) VALUES (?, ?), (?, ?)`, ID, currentUserID, ID, otherUserID)
+	if err != nil {
+		return 0, err
+	}
+	return int(ID), tx.Commit()
 }
 
 func (S *Server) FoundChat(currentUserID, otherUserID int) bool {
-	query := `SELECT id FROM chats WHERE (user1_id = ? AND user2_id = ?) OR (user1_id = ? AND user2_id = ?)`
+	query := `SELECT id FROM chats WHERE is_group = 0 AND ((user1_id = ? AND user2_id = ?) OR (user1_id = ? AND user2_id = ?))`
 	var id int
 	err := S.db.QueryRow(query, currentUserID, otherUserID, otherUserID, currentUserID).Scan(&id)
 	if err != nil {
@@ -129,33 +149,64 @@ func (S *Server) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	message.ChatID = chatID
-
-	valid := S.ValidateMessage(message)
-	if !valid {
-		tools.SendJSONError(w, "Invalid message data", http.StatusBadRequest)
-		return
-	}
-	message.SenderID = currentUserID
-	err = S.SendMessage(message)
+	message, err = S.SendDirectMessage(currentUserID, SessionID, message)
 	if err != nil {
-		tools.SendJSONError(w, "Failed to send message", http.StatusInternalServerError)
+		SendActionError(w, err)
 		return
 	}
 
-	resiverID := S.GetOtherUserID(currentUserID, message.ChatID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message)
+}
 
-	if S.Users[resiverID] != nil {
-		message.IsOwn = false
-		S.PushMessage("", resiverID, message)
+// SendDirectMessage stores a message of a direct chat and pushes it to the other participants
+// and to the sender's other sessions. sessionID is the session that sent it.
+func (S *Server) SendDirectMessage(currentUserID int, sessionID string, message Message) (Message, error) {
+	if err := S.CheckVerified(currentUserID); err != nil {
+		return Message{}, err
+	}
+	if !S.CheckIfCaneSendMessage(currentUserID, message.ChatID) {
+		return Message{}, NewActionError(http.StatusForbidden, "You are not a member of this chat")
 	}
 
-	if len(S.Users[currentUserID]) > 1 {
-		message.IsOwn = true
-		S.PushMessage(SessionID, currentUserID, message)
+	if !S.ValidateMessage(message) {
+		return Message{}, NewActionError(http.StatusBadRequest, "Invalid message data")
+	}
+	if err := S.CheckMediaContent(currentUserID, message.Type, message.Content); err != nil {
+		return Message{}, err
+	}
+	message.SenderID = currentUserID
+	message.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	if err := S.SendMessage(message); err != nil {
+		return Message{}, NewActionError(http.StatusInternalServerError, "Failed to send message")
+	}
+	if stored, err := S.getStoredMessage(message.ID); err == nil {
+		message.BackendID = stored.BackendID
+		if message.Type == "image" || message.Type == "gif" {
+			if err := S.LinkAttachment("message_id", stored.BackendID, message.Content); err != nil {
+				fmt.Println("Link Attachment Error : ", err)
+			}
+		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(message)
+	participants, err := S.GetChatParticipantIDs(message.ChatID)
+	if err != nil {
+		fmt.Println("Get Chat Participants Error : ", err)
+	}
+	for _, resiverID := range participants {
+		if resiverID != currentUserID && len(S.GetConnections(resiverID)) > 0 {
+			message.IsOwn = false
+			message.Muted = S.IsMuted(resiverID, currentUserID, "chat")
+			S.PushMessage("", resiverID, message)
+		}
+	}
+
+	message.IsOwn = true
+	message.Muted = false
+	if len(S.GetConnections(currentUserID)) > 1 {
+		S.PushMessage(sessionID, currentUserID, message)
+	}
+	return message, nil
 }
 
 func (S *Server) SendMessage(message Message) error {
@@ -187,41 +238,96 @@ func (S *Server) GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	messages, err := S.GetMessages(currentUserID, chatID)
+	page, err := ParsePage(r)
+	if err != nil {
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// ?around={messageID} opens the history at a given message, e.g. from a search result
+	var around *Cursor
+	if aroundID := r.URL.Query().Get("around"); aroundID != "" {
+		if page.Before != nil || page.After != nil {
+			tools.SendJSONError(w, "around cannot be used with before or after", http.StatusBadRequest)
+			return
+		}
+		stored, err := S.getStoredMessage(aroundID)
+		if err != nil || stored.ChatID != chatID {
+			tools.SendJSONError(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		around = NewCursor(stored.BackendID, stored.CreatedAt.UTC().Format(sqliteTimeLayout))
+	}
+
+	messages, nextCursor, newerCursor, err := ChatWindow(page, around, func(p Page) ([]Message, string, error) {
+		return S.GetMessages(currentUserID, chatID, p)
+	}, messageCursor)
 	if err != nil {
 		fmt.Println("Get Messages", err)
-		tools.RenderErrorPage(w, r, "Messages Not Found", http.StatusBadRequest)
+		tools.SendJSONError(w, "Failed to get messages", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(messages)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages":    messages,
+		"nextCursor":  nextCursor,
+		"newerCursor": newerCursor,
+	})
+}
+
+func messageCursor(message Message) string {
+	return EncodeCursor(message.BackendID, message.Timestamp)
 }
 
-func (S *Server) GetMessages(currentUserID int, chatID int) ([]Message, error) {
+// GetMessages returns one page of a chat's messages newest first, and the cursor of the following page
+func (S *Server) GetMessages(currentUserID int, chatID int, page Page) ([]Message, string, error) {
 	var messages []Message
-	query := `SELECT id, sender_id, content, type FROM messages WHERE chat_id = ?`
-	rows, err := S.db.Query(query, chatID)
+	condition, conditionArgs := page.Condition("m.created_at", "m.backend_id")
+	args := append([]interface{}{chatID, currentUserID}, conditionArgs...)
+	args = append(args, page.Limit+1)
+	query := `
+	SELECT m.backend_id, m.id, m.sender_id, m.content, m.type, m.is_deleted, m.edited_at, m.created_at,
+		NOT EXISTS (
+			SELECT 1 FROM chat_participants p
+			LEFT JOIN chat_reads r ON r.chat_id = p.chat_id AND r.user_id = p.user_id
+			WHERE p.chat_id = m.chat_id AND p.user_id != m.sender_id AND m.backend_id > COALESCE(r.last_read_id, 0)
+		) AS is_read
+	FROM messages m
+	WHERE m.chat_id = ? AND NOT EXISTS (
+		SELECT 1 FROM hidden_messages h WHERE h.message_id = m.backend_id AND h.user_id = ?)
+	AND ` + condition + `
+	ORDER BY ` + page.OrderBy("m.created_at", "m.backend_id", true) + `
+	LIMIT ?`
+	rows, err := S.db.Query(query, args...)
 	if err != nil {
 		fmt.Println("Get Messages Query Error : ", err)
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var message Message
-		err = rows.Scan(&message.ID, &message.SenderID, &message.Content, &message.Type)
+		var editedAt sql.NullString
+		err = rows.Scan(&message.BackendID, &message.ID, &message.SenderID, &message.Content, &message.Type, &message.IsDeleted, &editedAt, &message.Timestamp, &message.IsRead)
 		if err != nil {
 			fmt.Println("Get Messages Scan Error : ", err)
-			return nil, err
+			return nil, "", err
 		}
+		message.ChatID = chatID
+		message.EditedAt = editedAt.String
 		message.IsOwn = message.SenderID == currentUserID
 		messages = append(messages, message)
 	}
-	return messages, nil
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	messages, nextCursor := FinishPage(page, messages, true, messageCursor)
+	return messages, nextCursor, nil
 }
 
 func (S *Server) GetChatID(currentUserID, otherUserID int) int {
-	query := `SELECT id FROM chats WHERE (user1_id = ? AND user2_id = ?) OR (user1_id = ? AND user2_id = ?)`
+	query := `SELECT id FROM chats WHERE is_group = 0 AND ((user1_id = ? AND user2_id = ?) OR (user1_id = ? AND user2_id = ?))`
 	var id int
 	err := S.db.QueryRow(query, currentUserID, otherUserID, otherUserID, currentUserID).Scan(&id)
 	if err != nil {
@@ -232,8 +338,8 @@ func (S *Server) GetChatID(currentUserID, otherUserID int) int {
 }
 
 func (S *Server) GetAllChatIDs(currentUserID int) ([]int, error) {
-	query := `SELECT id FROM chats WHERE user1_id = ? OR user2_id = ?`
-	rows, err := S.db.Query(query, currentUserID, currentUserID)
+	query := `SELECT chat_id FROM chat_participants WHERE user_id = ?`
+	rows, err := S.db.Query(query, currentUserID)
 	if err != nil {
 		return nil, err
 	}
@@ -266,7 +372,8 @@ func (S *Server) GetOtherUserID(currentUserID, chatID int) int {
 
 func (S *Server) GetUsers(currentUserID int) ([]Chat, error) {
 	query := `
-	SELECT u.id, u.nickname, u.first_name || ' ' || u.last_name AS name, u.avatar, u.url, c.id AS chat_id
+	SELECT u.id, u.nickname, u.first_name || ' ' || u.last_name AS name, u.avatar, u.url, c.id AS chat_id,
+	` + chatUnreadSQL + ` AS unread_count
 	FROM
     chats c
     JOIN users u ON u.id = CASE
@@ -274,10 +381,13 @@ func (S *Server) GetUsers(currentUserID int) ([]Chat, error) {
         ELSE c.user1_id
     END
 	WHERE
-    c.user1_id = ?
-    OR c.user2_id = ?;
+    c.is_group = 0
+    AND (c.user1_id = ? OR c.user2_id = ?);
 	`
 	rows, err := S.db.Query(query,
+		currentUserID, // unread: sender
+		currentUserID, // unread: reader
+		currentUserID, // unread: muter
 		currentUserID, // 1st ?
 		currentUserID, // 2nd ?
 		currentUserID, // 3rd ?
@@ -300,6 +410,7 @@ func (S *Server) GetUsers(currentUserID int) ([]Chat, error) {
 			&c.Avatar,
 			&c.Url,
 			&c.ChatID,
+			&c.UnreadCount,
 		); err != nil {
 			fmt.Println("Get Users Scan Error : ", err)
 			return nil, err
@@ -316,8 +427,16 @@ func (S *Server) GetUsers(currentUserID int) ([]Chat, error) {
 
 		chats = append(chats, c)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return chats, nil
+	groupChats, err := S.GetGroupChats(currentUserID)
+	if err != nil {
+		fmt.Println("Get Group Chats Error : ", err)
+		return nil, err
+	}
+	return append(chats, groupChats...), nil
 }
 
 func (S *Server) GetMessageContent(messageID string) Message {
@@ -339,9 +458,9 @@ func (S *Server) GetChatIDFromMessageID(messageID string) (string, error) {
 }
 
 func (S *Server) CheckIfCaneSendMessage(currentUserID, chatID int) bool {
-	query := `SELECT id FROM chats WHERE id = ? AND (user1_id = ? OR user2_id = ?)`
+	query := `SELECT chat_id FROM chat_participants WHERE chat_id = ? AND user_id = ?`
 	var id int
-	err := S.db.QueryRow(query, chatID, currentUserID, currentUserID).Scan(&id)
+	err := S.db.QueryRow(query, chatID, currentUserID).Scan(&id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return false
@@ -0,0 +1,175 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// muteActiveSQL holds for a row mu of mutes that has not expired
+const muteActiveSQL = `(mu.expires_at IS NULL OR mu.expires_at > datetime('now'))`
+
+// MuteUserHandler sets what the current user mutes of another user, replacing the previous settings.
+// Following is left untouched and the muted user is not told. Muting nothing unmutes.
+func (S *Server) MuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		UserID int `json:"userId"`
+		MuteSettings
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if body.UserID == currentUserID {
+		tools.SendJSONError(w, "cannot mute yourself", http.StatusBadRequest)
+		return
+	}
+
+	var expiresAt interface{}
+	if body.ExpiresAt != "" {
+		until, err := time.Parse(time.RFC3339, body.ExpiresAt)
+		if err != nil {
+			tools.SendJSONError(w, "expiresAt must be an RFC 3339 date", http.StatusBadRequest)
+			return
+		}
+		if !until.After(time.Now()) {
+			tools.SendJSONError(w, "expiresAt must be in the future", http.StatusBadRequest)
+			return
+		}
+		expiresAt = until.UTC().Format("2006-01-02 15:04:05")
+		body.ExpiresAt = until.UTC().Format(time.RFC3339)
+	}
+
+	var exists bool
+	if err := S.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)`, body.UserID).Scan(&exists); err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		tools.SendJSONError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	var err error
+	if !body.Posts && !body.Comments && !body.Notifications && !body.Chat {
+		_, err = S.db.Exec(`DELETE FROM mutes WHERE user_id = ? AND muted_id = ?`, currentUserID, body.UserID)
+		body.ExpiresAt = ""
+	} else {
+		_, err = S.db.Exec(`
+			INSERT INTO mutes (user_id, muted_id, posts, comments, notifications, chat, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(user_id, muted_id) DO UPDATE SET
+				posts = excluded.posts,
+				comments = excluded.comments,
+				notifications = excluded.notifications,
+				chat = excluded.chat,
+				expires_at = excluded.expires_at
+		`, currentUserID, body.UserID, body.Posts, body.Comments, body.Notifications, body.Chat, expiresAt)
+	}
+	if err != nil {
+		fmt.Println("Mute User Error : ", err)
+		tools.SendJSONError(w, "failed to mute user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// UnmuteUserHandler lifts every mute the current user set on another user
+func (S *Server) UnmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		UserID int `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := S.db.Exec(`DELETE FROM mutes WHERE user_id = ? AND muted_id = ?`, currentUserID, body.UserID); err != nil {
+		tools.SendJSONError(w, "failed to unmute user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"userId": body.UserID, "muted": false})
+}
+
+// GetMutedUsersHandler lists the users the current user has muted, with what is muted.
+// Expired mutes are left out.
+func (S *Server) GetMutedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := S.db.Query(`
+		SELECT u.id, u.first_name || ' ' || u.last_name, COALESCE(u.nickname, ''), COALESCE(u.avatar, ''), u.url,
+			mu.posts, mu.comments, mu.notifications, mu.chat, mu.expires_at
+		FROM mutes mu
+		JOIN users u ON u.id = mu.muted_id
+		WHERE mu.user_id = ? AND `+muteActiveSQL+`
+		ORDER BY mu.created_at DESC, mu.rowid DESC
+	`, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	muted := []MutedUser{}
+	for rows.Next() {
+		var user MutedUser
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&user.ID, &user.Name, &user.Username, &user.Avatar, &user.Url,
+			&user.Posts, &user.Comments, &user.Notifications, &user.Chat, &expiresAt); err != nil {
+			fmt.Println("Get Muted Users Error : ", err)
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if expiresAt.Valid {
+			user.ExpiresAt = expiresAt.Time.UTC().Format(time.RFC3339)
+		}
+		muted = append(muted, user)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(muted)
+}
+
+// IsMuted reports whether userID currently mutes kind ("posts", "comments", "notifications"
+// or "chat") of mutedID
+func (S *Server) IsMuted(userID, mutedID int, kind string) bool {
+	condition, args := NotMutedCondition(kind, "?", userID)
+	var notMuted bool
+	if err := S.db.QueryRow(`SELECT `+condition, append(args, mutedID)...).Scan(&notMuted); err != nil {
+		fmt.Println("Is Muted Error : ", err)
+		return false
+	}
+	return !notMuted
+}
+
+// NotMutedCondition returns the SQL condition under which viewerID has not muted kind of the
+// user in column. kind is a column of mutes, never user input.
+func NotMutedCondition(kind, column string, viewerID int) (string, []interface{}) {
+	return `NOT EXISTS (
+		SELECT 1 FROM mutes mu
+		WHERE mu.user_id = ? AND mu.muted_id = ` + column + ` AND mu.` + kind + ` = 1 AND ` + muteActiveSQL + `
+	)`, []interface{}{viewerID}
+}
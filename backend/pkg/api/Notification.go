@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 func (S *Server) GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
@@ -15,14 +16,26 @@ func (S *Server) GetNotificationsHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	page, err := ParsePage(r)
+	if err != nil {
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// notifications from muted users are kept and show up again once the mute ends
+	notMuted, notMutedArgs := NotMutedCondition("notifications", "n.actor_id", userID)
+	condition, conditionArgs := page.Condition("n.created_at", "n.id")
+	args := append(append([]interface{}{userID}, notMutedArgs...), conditionArgs...)
+	args = append(args, page.Limit+1)
 	rows, err := S.db.QueryContext(r.Context(), `
-		SELECT n.id, n.type, n.content, n.is_read, n.created_at,
+		SELECT n.id, n.type, n.content, n.is_read, n.created_at, n.reference_id,
 		       u.id, u.first_name, u.last_name, u.avatar
 		FROM notifications n
 		JOIN users u ON u.id = n.actor_id
-		WHERE n.user_id = ?
-		ORDER BY n.created_at DESC
-	`, userID)
+		WHERE n.user_id = ? AND `+notMuted+` AND `+condition+`
+		ORDER BY `+page.OrderBy("n.created_at", "n.id", true)+`
+		LIMIT ?
+	`, args...)
 	if err != nil {
 		fmt.Println("DB error:", err)
 		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
@@ -33,7 +46,8 @@ func (S *Server) GetNotificationsHandler(w http.ResponseWriter, r *http.Request)
 	var notifs []map[string]interface{}
 	for rows.Next() {
 		var notif Notification
-		if err := rows.Scan(&notif.ID, &notif.Type, &notif.Content, &notif.IsRead, &notif.CreatedAt,
+		var referenceID sql.NullInt64
+		if err := rows.Scan(&notif.ID, &notif.Type, &notif.Content, &notif.IsRead, &notif.CreatedAt, &referenceID,
 			&notif.ActorID, &notif.FirstName, &notif.LastName, &notif.Avatar); err != nil {
 			fmt.Println("Error scanning row:", err)
 			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
@@ -41,11 +55,12 @@ func (S *Server) GetNotificationsHandler(w http.ResponseWriter, r *http.Request)
 		}
 
 		notifs = append(notifs, map[string]interface{}{
-			"id":        notif.ID,
-			"type":      notif.Type,
-			"content":   notif.Content,
-			"isRead":    notif.IsRead,
-			"timestamp": notif.CreatedAt,
+			"id":          notif.ID,
+			"type":        notif.Type,
+			"content":     notif.Content,
+			"isRead":      notif.IsRead,
+			"timestamp":   notif.CreatedAt,
+			"referenceId": referenceID.Int64,
 			"user": map[string]interface{}{
 				"id":     notif.ActorID,
 				"name":   notif.FirstName + " " + notif.LastName,
@@ -54,20 +69,37 @@ func (S *Server) GetNotificationsHandler(w http.ResponseWriter, r *http.Request)
 		})
 	}
 
+	notifs, nextCursor := FinishPage(page, notifs, true, func(notif map[string]interface{}) string {
+		return EncodeCursor(notif["id"].(int), notif["timestamp"].(time.Time).Format(time.RFC3339))
+	})
+
+	var unreadCount int
+	if err := S.db.QueryRow(`
+		SELECT COUNT(*) FROM notifications n WHERE n.user_id = ? AND n.is_read = 0 AND `+notMuted+`
+	`, append([]interface{}{userID}, notMutedArgs...)...).Scan(&unreadCount); err != nil {
+		fmt.Println("DB error:", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(notifs)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifs,
+		"nextCursor":    nextCursor,
+		"unreadCount":   unreadCount,
+	})
 }
 
 func (S *Server) InsertNotification(notif Notification) error {
 	_, err := S.db.Exec(`
-		INSERT INTO notifications (user_id, actor_id, type, content, is_read)
-		VALUES (?, ?, ?, ?, ?)
-	`, notif.ID, notif.ActorID, notif.Type, notif.Content, notif.IsRead)
+		INSERT INTO notifications (user_id, actor_id, type, content, is_read, reference_id)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, 0))
+	`, notif.ID, notif.ActorID, notif.Type, notif.Content, notif.IsRead, notif.ReferenceID)
 	return err
 }
 
 func (S *Server) MarkNotificationAsReadHandler(w http.ResponseWriter, r *http.Request) {
-	banned, _ := S.ActionMiddleware(r, http.MethodPut, true, false)
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPut, true, false)
 	if banned {
 		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -79,34 +111,47 @@ func (S *Server) MarkNotificationAsReadHandler(w http.ResponseWriter, r *http.Re
 		tools.SendJSONError(w, "invalid notification ID", http.StatusBadRequest)
 		return
 	}
-	_, err := S.db.Exec(`
-		UPDATE notifications
-		SET is_read = 1
-		WHERE id = ?
-	`, notificationID)
-	if err != nil {
-		if err != sql.ErrNoRows {
-			S.ActionMiddleware(r, http.MethodPut, true, true)
-			tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
-			return
+	if err := S.MarkNotificationAsRead(notificationID, currentUserID); err != nil {
+		if actionErr, ok := err.(*ActionError); ok && actionErr.Status == http.StatusUnauthorized {
+			S.RecordStrike(r, currentUserID, "marking another user's notification as read")
 		}
-		fmt.Println("DB error:", err)
-		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		SendActionError(w, err)
 		return
 	}
+}
 
+// MarkNotificationAsRead marks one of currentUserID's notifications as read
+func (S *Server) MarkNotificationAsRead(notificationID, currentUserID int) error {
 	_, receiverID, err := S.GetSenderAndReceiverIDs(notificationID)
 	if err != nil {
-		fmt.Println("DB error:", err)
-		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+		if err == sql.ErrNoRows {
+			return NewActionError(http.StatusNotFound, "Notification not found")
+		}
+		return err
+	}
+	if receiverID != currentUserID {
+		return NewActionError(http.StatusUnauthorized, "Unauthorized")
+	}
+
+	_, err = S.db.Exec(`
+		UPDATE notifications
+		SET is_read = 1
+		WHERE id = ?
+	`, notificationID)
+	if err != nil {
+		return err
 	}
 
 	S.PushNotification("-read", receiverID, Notification{})
+	return nil
 }
 
 func (S *Server) DeleteNotificationHandler(w http.ResponseWriter, r *http.Request) {
 	banned, UserId := S.ActionMiddleware(r, http.MethodDelete, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
 	ID := r.URL.Path[len("/api/delete-notification/"):]
 	checknotificationID, notificationID := tools.IsNumeric(ID)
@@ -115,18 +160,10 @@ func (S *Server) DeleteNotificationHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	senderID, receiverID, err := S.GetSenderAndReceiverIDs(notificationID)
-
-	if banned || (receiverID != UserId && senderID == UserId) {
-		S.ActionMiddleware(r, http.MethodDelete, true, true)
-		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
+	_, receiverID, err := S.GetSenderAndReceiverIDs(notificationID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			S.ActionMiddleware(r, http.MethodDelete, true, true)
-			tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			tools.SendJSONError(w, "Notification not found", http.StatusNotFound)
 			return
 		}
 		fmt.Println("DB error:", err)
@@ -134,6 +171,12 @@ func (S *Server) DeleteNotificationHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if receiverID != UserId {
+		S.RecordStrike(r, UserId, "deleting another user's notification")
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	_, err = S.db.Exec(`
 		DELETE FROM notifications
 		WHERE id = ?
@@ -156,6 +199,17 @@ func (S *Server) DeleteNotification(senderID, resiverID int, notificationType st
 	return err
 }
 
+// DeleteReferencedNotification removes a notification tied to a specific object,
+// e.g. the "like" sent for one post when the reaction is taken back.
+func (S *Server) DeleteReferencedNotification(senderID, resiverID int, notificationType string, referenceID int) error {
+	_, err := S.db.Exec(`
+		DELETE FROM notifications
+		WHERE actor_id = ? AND user_id = ? AND type = ? AND reference_id = ?
+	`, senderID, resiverID, notificationType, referenceID)
+
+	return err
+}
+
 func (S *Server) GetSenderAndReceiverIDs(notificationID int) (int, int, error) {
 	var senderID, receiverID int
 	err := S.db.QueryRow(`
@@ -176,15 +230,22 @@ func (S *Server) MarkAllNotificationAsReadHandler(w http.ResponseWriter, r *http
 		return
 	}
 
+	if err := S.MarkAllNotificationsAsRead(currentUserID); err != nil {
+		tools.SendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (S *Server) MarkAllNotificationsAsRead(currentUserID int) error {
 	_, err := S.db.Exec(`
 		UPDATE notifications
 		SET is_read = 1
 		WHERE user_id = ?
 	`, currentUserID)
 	if err != nil {
-		tools.SendJSONError(w, "DB error: "+err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
 
 	S.PushNotification("-all-read", currentUserID, Notification{})
+	return nil
 }
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -30,6 +31,7 @@ type UserData struct {
 	AboutMe             string `json:"aboutMe,omitempty"`
 	Age                 int    `json:"age"`
 	IsPrivate           bool   `json:"isPrivate"`
+	EmailVerified       bool   `json:"emailVerified"`
 	FollowersCount      int    `json:"followersCount"`
 	FollowingCount      int    `json:"followingCount"`
 	PostsCount          int    `json:"postsCount"`
@@ -42,32 +44,47 @@ type UserData struct {
 type LoginUser struct {
 	Identifier string `json:"identifier"`
 	Password   string `json:"password"`
+	Remember   bool   `json:"remember"`
 }
 
 type Post struct {
-	ID                int      `json:"id"`
-	UserID            int      `json:"-"`
-	GroupID           int      `json:"groupId,omitempty"`
-	Content           string   `json:"content"`
-	Image             *string  `json:"image,omitempty"`
-	Privacy           string   `json:"privacy"`
-	CreatedAt         string   `json:"createdAt"`
-	Likes             int      `json:"likes"`
-	Comments          int      `json:"comments"`
-	Author            Author   `json:"author"`
-	SelectedFollowers []string `json:"selectedFollowers,omitempty"`
+	ID                int            `json:"id"`
+	UserID            int            `json:"-"`
+	GroupID           int            `json:"groupId,omitempty"`
+	Content           string         `json:"content"`
+	Image             *string        `json:"image,omitempty"`
+	Privacy           string         `json:"privacy"`
+	CreatedAt         string         `json:"createdAt"`
+	EditedAt          string         `json:"editedAt,omitempty"`
+	Likes             int            `json:"likes"`
+	Reactions         map[string]int `json:"reactions"`
+	UserReaction      string         `json:"userReaction,omitempty"`
+	Comments          int            `json:"comments"`
+	Author            Author         `json:"author"`
+	SelectedFollowers []string       `json:"selectedFollowers,omitempty"`
+	AudienceLists     []int          `json:"audienceLists,omitempty"` // private posts: lists shared with
+}
+
+type PostRevision struct {
+	ID        int     `json:"id"`
+	PostID    int     `json:"postId"`
+	Content   string  `json:"content"`
+	Image     *string `json:"image,omitempty"`
+	Privacy   string  `json:"privacy"`
+	CreatedAt string  `json:"createdAt"`
 }
 
 type Notification struct {
-	ID        int       `json:"id"`
-	Type      string    `json:"type"`
-	Content   string    `json:"content"`
-	IsRead    bool      `json:"isRead"`
-	CreatedAt time.Time `json:"timestamp"`
-	ActorID   int       `json:"actorId"`
-	FirstName string    `json:"firstName"`
-	LastName  string    `json:"lastName"`
-	Avatar    string    `json:"avatar"`
+	ID          int       `json:"id"`
+	Type        string    `json:"type"`
+	Content     string    `json:"content"`
+	IsRead      bool      `json:"isRead"`
+	CreatedAt   time.Time `json:"timestamp"`
+	ActorID     int       `json:"actorId"`
+	FirstName   string    `json:"firstName"`
+	LastName    string    `json:"lastName"`
+	Avatar      string    `json:"avatar"`
+	ReferenceID int       `json:"referenceId,omitempty"` // post (or other object) the notification is about
 }
 
 type Author = struct {
@@ -79,23 +96,160 @@ type Author = struct {
 }
 
 type Message struct {
+	BackendID int    `json:"-"`
 	ID        string `json:"id"`
 	ChatID    int    `json:"chat_id"`
 	SenderID  int    `json:"sender_id"`
 	Content   string `json:"content"`
 	Type      string `json:"type"`
 	IsOwn     bool   `json:"isOwn"`
+	IsRead    bool   `json:"isRead"` // every other participant has read it
+	IsDeleted bool   `json:"isDeleted,omitempty"`
+	EditedAt  string `json:"editedAt,omitempty"`
 	Timestamp string `json:"timestamp"`
+	Muted     bool   `json:"muted,omitempty"` // the recipient muted the sender's chat
 }
 
 type Chat struct {
-	ChatID   int    `json:"id"`
+	ChatID      int    `json:"id"`
+	Name        string `json:"name"`
+	UserID      int    `json:"userId,omitempty"`
+	Url         string `json:"otherUserId,omitempty"`
+	Username    string `json:"username"`
+	Avatar      string `json:"avatar"`
+	IsOnline    bool   `json:"isOnline,omitempty"`
+	UnreadCount int    `json:"unreadCount"`
+
+	// group DMs only
+	IsGroup      bool              `json:"isGroup,omitempty"`
+	Title        string            `json:"title,omitempty"`
+	CreatedBy    int               `json:"createdBy,omitempty"`
+	Participants []ChatParticipant `json:"participants,omitempty"`
+}
+
+type ChatParticipant struct {
+	ID       int    `json:"id"`
 	Name     string `json:"name"`
-	UserID   int    `json:"userId,omitempty"`
-	Url      string `json:"otherUserId,omitempty"`
-	Username string `json:"username"`
+	Username string `json:"username,omitempty"`
 	Avatar   string `json:"avatar"`
-	IsOnline bool   `json:"isOnline,omitempty"`
+	Url      string `json:"url"`
+	JoinedAt string `json:"joinedAt"`
+}
+
+// SearchHit is one result of /api/search. Snippet holds the matching text with <mark> tags.
+type SearchHit struct {
+	ID        int         `json:"id"`
+	PostID    int         `json:"postId,omitempty"`  // comments
+	GroupID   int         `json:"groupId,omitempty"` // group posts and comments, groups
+	Title     string      `json:"title,omitempty"`   // groups
+	Snippet   string      `json:"snippet"`
+	CreatedAt string      `json:"createdAt"`
+	User      *SearchUser `json:"user,omitempty"` // the author, or the user found
+}
+
+type SearchUser struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username,omitempty"`
+	Avatar   string `json:"avatar"`
+	Url      string `json:"url"`
+}
+
+// BlockedUser is an entry of the current user's block list
+type BlockedUser struct {
+	SearchUser
+	BlockedAt string `json:"blockedAt"`
+}
+
+// MuteSettings says which of a user's activity the current user has muted
+type MuteSettings struct {
+	Posts         bool   `json:"posts"`         // hidden from feeds
+	Comments      bool   `json:"comments"`      // hidden under posts
+	Notifications bool   `json:"notifications"` // hidden from the notification list
+	Chat          bool   `json:"chat"`          // messages pushed with "muted" and left out of unread counts
+	ExpiresAt     string `json:"expiresAt,omitempty"`
+}
+
+// MutedUser is an entry of the current user's mute list
+type MutedUser struct {
+	SearchUser
+	MuteSettings
+}
+
+// Session is one device the user is logged in on. ID identifies it to the API without
+// revealing the cookie value.
+type Session struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"userAgent"`
+	IP         string `json:"ip"`
+	CreatedAt  string `json:"createdAt"`
+	LastSeenAt string `json:"lastSeenAt"`
+	ExpiresAt  string `json:"expiresAt"`
+	Remember   bool   `json:"remember"`
+	Current    bool   `json:"current"`
+}
+
+// SecurityEvent is an entry of a user's security log
+type SecurityEvent struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"userId"`
+	Event     string `json:"event"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	Endpoint  string `json:"endpoint"`
+	Reason    string `json:"reason"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// Suspension is a suspended account's reason, end and appeal. Until is empty for a suspension
+// that lasts until a moderator lifts it; Automatic is set when no moderator made it.
+type Suspension struct {
+	UserID      int     `json:"userId"`
+	Nickname    string  `json:"nickname"`
+	Reason      string  `json:"reason"`
+	Until       string  `json:"until"`
+	SuspendedAt string  `json:"suspendedAt"`
+	Automatic   bool    `json:"automatic"`
+	Appeal      *Appeal `json:"appeal"`
+}
+
+// Appeal is a suspended user's request to lift their suspension
+type Appeal struct {
+	ID        int    `json:"id"`
+	Message   string `json:"message"`
+	Status    string `json:"status"`
+	Response  string `json:"response"`
+	CreatedAt string `json:"createdAt"`
+	DecidedAt string `json:"decidedAt"`
+}
+
+// AudienceList is a named list of followers private posts can be shared with
+type AudienceList struct {
+	ID        int          `json:"id"`
+	Name      string       `json:"name"`
+	Members   []SearchUser `json:"members"`
+	CreatedAt string       `json:"createdAt"`
+}
+
+// MentionSuggestion is a user offered by the @mention autocomplete
+type MentionSuggestion struct {
+	SearchUser
+	Following   bool `json:"following"`   // the current user follows them
+	GroupMember bool `json:"groupMember"` // they share a group with the current user
+}
+
+// TrendingTag is a hashtag scored by RefreshTrending
+type TrendingTag struct {
+	Tag   string  `json:"tag"`
+	Score float64 `json:"score"`
+	Uses  int     `json:"uses"`  // posts and comments using it in the window
+	Users int     `json:"users"` // distinct authors
+}
+
+type Trending struct {
+	Tags       []TrendingTag `json:"tags"`
+	Window     string        `json:"window"`
+	ComputedAt string        `json:"computedAt,omitempty"`
 }
 
 type Follower struct {
@@ -113,15 +267,23 @@ type Comment struct {
 		Username string `json:"username,omitempty"`
 		Avatar   string `json:"avatar,omitempty"`
 	} `json:"author,omitempty"`
+	PostID    int    `json:"postId"`
+	ParentID  int    `json:"parentId,omitempty"`
+	Depth     int    `json:"depth"`
+	Replies   int    `json:"replies"`
 	Content   string `json:"content"`
 	Type      string `json:"type"`
 	CreatedAt string `json:"createdAt"`
+	EditedAt  string `json:"editedAt,omitempty"`
+	IsOwn     bool   `json:"isOwn"`
 }
 
 type CommentRequest struct {
-	PostID  int    `json:"postId"`
-	Content string `json:"content"`
-	Type    string `json:"type"`
+	PostID          int    `json:"postId"`
+	ParentCommentID *int   `json:"parentCommentId"`
+	Content         string `json:"content"`
+	Type            string `json:"type"`
+	Subscribe       bool   `json:"subscribe"` // also get notified of later comments on the post
 }
 
 type Group struct {
@@ -133,6 +295,21 @@ type Group struct {
 	CreatedAt   string `json:"createdAt"`
 	IsMember    bool   `json:"isMember,omitempty"`
 	IsCreator   bool   `json:"isCreator,omitempty"`
+	UnreadCount int    `json:"unreadCount,omitempty"`
+}
+
+// WSRequest is a frame a client sends over the WebSocket.
+// ID is echoed back in the "ack" or "error" frame answering it.
+type WSRequest struct {
+	Version int             `json:"v"`
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type ReactionRequest struct {
+	PostID int    `json:"postId"`
+	Type   string `json:"type"`
 }
 
 type GroupMember struct {
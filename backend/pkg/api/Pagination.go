@@ -0,0 +1,199 @@
+package backend
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 50
+)
+
+// sqliteTimeLayout is how CURRENT_TIMESTAMP stores created_at columns
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// Cursor marks a position in a list ordered by (created_at, id).
+// Clients only ever see it base64 encoded.
+type Cursor struct {
+	ID        int    `json:"id"`
+	CreatedAt string `json:"t"`
+}
+
+// Page is a pagination request: at most Limit rows older (Before) or newer (After) than a cursor
+type Page struct {
+	Limit  int
+	Before *Cursor
+	After  *Cursor
+}
+
+// ParsePage reads the limit, before and after query parameters
+func ParsePage(r *http.Request) (Page, error) {
+	page := Page{Limit: DefaultPageSize}
+	query := r.URL.Query()
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return Page{}, fmt.Errorf("invalid limit")
+		}
+		if n > MaxPageSize {
+			n = MaxPageSize
+		}
+		page.Limit = n
+	}
+
+	before, after := query.Get("before"), query.Get("after")
+	if before != "" && after != "" {
+		return Page{}, fmt.Errorf("before and after cannot be used together")
+	}
+
+	var err error
+	if before != "" {
+		if page.Before, err = DecodeCursor(before); err != nil {
+			return Page{}, err
+		}
+	}
+	if after != "" {
+		if page.After, err = DecodeCursor(after); err != nil {
+			return Page{}, err
+		}
+	}
+	return page, nil
+}
+
+// NewCursor builds the cursor of a row. createdAt may be RFC3339 (as scanned by the
+// sqlite driver) or already in the CURRENT_TIMESTAMP layout.
+func NewCursor(id int, createdAt string) *Cursor {
+	if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+		createdAt = t.UTC().Format(sqliteTimeLayout)
+	}
+	return &Cursor{ID: id, CreatedAt: createdAt}
+}
+
+// Encode returns the opaque form handed to clients
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func EncodeCursor(id int, createdAt string) string {
+	return NewCursor(id, createdAt).Encode()
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if _, err := time.Parse(sqliteTimeLayout, c.CreatedAt); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &c, nil
+}
+
+// Descending reports whether rows are scanned newest first. newestFirst is the
+// natural order of the list when no cursor is given.
+func (p Page) Descending(newestFirst bool) bool {
+	if p.Before != nil {
+		return true
+	}
+	if p.After != nil {
+		return false
+	}
+	return newestFirst
+}
+
+// Condition returns the WHERE fragment selecting rows past the cursor and its arguments
+func (p Page) Condition(createdAtCol, idCol string) (string, []interface{}) {
+	c, op := p.Before, "<"
+	if p.After != nil {
+		c, op = p.After, ">"
+	}
+	if c == nil {
+		return "1 = 1", nil
+	}
+	return fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?))", createdAtCol, op, createdAtCol, idCol, op),
+		[]interface{}{c.CreatedAt, c.CreatedAt, c.ID}
+}
+
+// OrderBy returns the ORDER BY clause matching the scan direction
+func (p Page) OrderBy(createdAtCol, idCol string, newestFirst bool) string {
+	dir := "ASC"
+	if p.Descending(newestFirst) {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("%s %s, %s %s", createdAtCol, dir, idCol, dir)
+}
+
+// FinishPage trims items fetched with Limit+1 rows back to Limit and returns the cursor of
+// the next page ("" when there is none). Rows scanned against the list's natural order are
+// put back in natural order.
+func FinishPage[T any](p Page, items []T, newestFirst bool, cursorOf func(T) string) ([]T, string) {
+	next := ""
+	if len(items) > p.Limit {
+		items = items[:p.Limit]
+		next = cursorOf(items[len(items)-1])
+	}
+	if p.Descending(newestFirst) != newestFirst {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	return items, next
+}
+
+// ChatWindow loads one window of a chat history and returns it oldest message first, with the
+// cursors of the older and newer windows ("" when there is nothing more that way).
+// fetch runs one Page newest first, as FinishPage(p, items, true, cursorOf) returns it.
+// around, when set, centers the window on that message.
+func ChatWindow[T any](p Page, around *Cursor, fetch func(Page) ([]T, string, error), cursorOf func(T) string) ([]T, string, string, error) {
+	var items []T
+	var older, newer string
+
+	switch {
+	case around != nil:
+		// the older half includes the message itself
+		olderHalf, olderNext, err := fetch(Page{Limit: p.Limit/2 + 1, Before: &Cursor{ID: around.ID + 1, CreatedAt: around.CreatedAt}})
+		if err != nil {
+			return nil, "", "", err
+		}
+		newerHalf, newerNext, err := fetch(Page{Limit: p.Limit - p.Limit/2, After: around})
+		if err != nil {
+			return nil, "", "", err
+		}
+		items = append(newerHalf, olderHalf...)
+		older, newer = olderNext, newerNext
+
+	case p.After != nil:
+		var err error
+		if items, newer, err = fetch(p); err != nil {
+			return nil, "", "", err
+		}
+		if len(items) > 0 {
+			older = cursorOf(items[len(items)-1])
+		}
+
+	default:
+		var err error
+		if items, older, err = fetch(p); err != nil {
+			return nil, "", "", err
+		}
+		if p.Before != nil && len(items) > 0 {
+			newer = cursorOf(items[0])
+		}
+	}
+
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items, older, newer, nil
+}
@@ -35,13 +35,32 @@ func (S *Server) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var followers []int
+	if post.Privacy == "private" {
+		followers, err = S.CheckPostAudience(userID, post.SelectedFollowers, post.AudienceLists)
+		if err != nil {
+			SendActionError(w, err)
+			return
+		}
+	} else {
+		post.AudienceLists = nil
+	}
+
 	if post.Image != nil {
 		trimmed := strings.TrimPrefix(*post.Image, "/")
 		post.Image = &trimmed
 	}
 
+	// the post, its hashtags and its audience are written together
+	tx, err := S.db.Begin()
+	if err != nil {
+		tools.SendJSONError(w, "failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
 	// Insert into database
-	res, err := S.db.Exec(`
+	res, err := tx.Exec(`
         INSERT INTO posts (user_id, content, image, privacy)
         VALUES (?, ?, ?, ?)`,
 		userID, html.EscapeString(post.Content), post.Image, post.Privacy,
@@ -63,67 +82,118 @@ func (S *Server) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	post.UserID = userID
 	post.CreatedAt = time.Now().Format(time.RFC3339)
 
-	if post.Privacy == "private" {
-		for _, followerID := range post.SelectedFollowers {
-			_, err = S.db.Exec(`
-				INSERT INTO posts_private (post_id, user_id)
-				VALUES (?, ?)`,
-				post.ID, followerID,
-			)
-			if err != nil {
-				fmt.Println("Error inserting follower:", err)
-				tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
-				return
-			}
-		}
+	if err := IndexPostHashtags(tx, post.ID, post.Content); err != nil {
+		fmt.Println("Error indexing hashtags:", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
 
+	if err := SavePostAudience(tx, post.ID, followers, post.AudienceLists); err != nil {
+		fmt.Println("Error saving post audience:", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		tools.SendJSONError(w, "failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	S.UpdateMentions("post", post.ID, userID, post.Content)
+
 	Post, err := S.GetPostFromID(post.ID, userID)
 	if err != nil {
 		tools.SendJSONError(w, "DB Error", http.StatusInternalServerError)
 		return
 	}
 
-	S.PushNewPost(userID, map[string]interface{}{
-		"post": Post,
-	})
+	S.PushNewPost(Post)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(Post)
 }
 
-func (S *Server) GetAllPosts(targetedUserID, currentUserID int) ([]Post, error) {
-	qery := ``
+// PostVisibleCondition returns the SQL condition under which viewerID may see post p,
+// the same rules CheckPostPrivacy applies to a single post
+func PostVisibleCondition(viewerID int) (string, []interface{}) {
+	notBlocked, notBlockedArgs := NotBlockedCondition("p.user_id", viewerID)
+	return notBlocked + ` AND ` + NotSuspendedCondition("p.user_id") + ` AND (
+		p.user_id = ?
+		OR (p.group_id IS NOT NULL AND EXISTS (
+			SELECT 1 FROM group_members gm WHERE gm.group_id = p.group_id AND gm.user_id = ?))
+		OR (p.group_id IS NULL AND (
+			p.privacy = 'public'
+			OR (p.privacy = 'almost-private' AND EXISTS (
+				SELECT 1 FROM follows f WHERE f.follower_id = ? AND f.following_id = p.user_id))
+			OR (p.privacy = 'private' AND (EXISTS (
+				SELECT 1 FROM posts_private pp WHERE pp.post_id = p.id AND pp.user_id = ?)
+				OR ` + audienceMemberSQL + `))
+		))
+	)`, append(notBlockedArgs, viewerID, viewerID, viewerID, viewerID, viewerID)
+}
+
+// GetAllPosts returns one page of the non-group posts the current user is allowed to see,
+// newest first, optionally limited to one author, and the cursor of the following page.
+// Without an author, posts of accounts the current user muted are left out; a muted
+// account's own profile still lists its posts.
+func (S *Server) GetAllPosts(targetedUserID, currentUserID int, page Page) ([]Post, string, error) {
+	filter := `p.group_id IS NULL`
 	args := []interface{}{}
 	if targetedUserID != 0 {
-		qery = `
-	SELECT 
-			p.id, p.content, p.image, p.created_at, p.privacy,
-			u.id, u.first_name, u.last_name, u.nickname, u.avatar, u.is_private, u.url,
-			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comment_count
-		FROM posts p
-		JOIN users u ON p.user_id = u.id
-		WHERE p.user_id = ? AND p.group_id IS NULL
-		ORDER BY p.id DESC
-	`
+		filter += ` AND p.user_id = ?`
 		args = append(args, targetedUserID)
 	} else {
-		qery = `
+		notMuted, notMutedArgs := NotMutedCondition("posts", "p.user_id", currentUserID)
+		filter += ` AND ` + notMuted
+		args = append(args, notMutedArgs...)
+	}
+	return S.QueryPosts(filter, args, currentUserID, page)
+}
+
+// GetHomeFeed returns the viewer's timeline: their own posts, posts of the accounts they
+// follow and posts of the groups they belong to, newest first, without muted accounts
+func (S *Server) GetHomeFeed(currentUserID int, page Page) ([]Post, string, error) {
+	notMuted, notMutedArgs := NotMutedCondition("posts", "p.user_id", currentUserID)
+	filter := `(
+		p.user_id = ?
+		OR p.user_id IN (SELECT following_id FROM follows WHERE follower_id = ?)
+		OR p.group_id IN (SELECT group_id FROM group_members WHERE user_id = ?)
+	) AND ` + notMuted
+	args := append([]interface{}{currentUserID, currentUserID, currentUserID}, notMutedArgs...)
+	return S.QueryPosts(filter, args, currentUserID, page)
+}
+
+// GetExplorePosts returns public posts from everyone but muted accounts, newest first
+func (S *Server) GetExplorePosts(currentUserID int, page Page) ([]Post, string, error) {
+	notMuted, notMutedArgs := NotMutedCondition("posts", "p.user_id", currentUserID)
+	return S.QueryPosts(`p.group_id IS NULL AND p.privacy = 'public' AND `+notMuted, notMutedArgs, currentUserID, page)
+}
+
+// QueryPosts returns one page of the posts matching filter that the current user may see,
+// newest first, and the cursor of the following page
+func (S *Server) QueryPosts(filter string, filterArgs []interface{}, currentUserID int, page Page) ([]Post, string, error) {
+	visible, visibleArgs := PostVisibleCondition(currentUserID)
+	condition, conditionArgs := page.Condition("p.created_at", "p.id")
+
+	args := append([]interface{}{}, filterArgs...)
+	args = append(args, visibleArgs...)
+	args = append(args, conditionArgs...)
+	args = append(args, page.Limit+1)
+
+	rows, err := S.db.Query(`
 	SELECT 
-			p.id, p.content, p.image, p.created_at, p.privacy,
+			p.id, p.content, p.image, p.created_at, p.edited_at, p.privacy, p.group_id,
 			u.id, u.first_name, u.last_name, u.nickname, u.avatar, u.is_private, u.url,
 			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comment_count
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
-		WHERE p.group_id IS NULL
-		ORDER BY p.id DESC
-	`
-	}
-	rows, err := S.db.Query(qery, args...)
-
+		WHERE `+filter+` AND `+visible+` AND `+condition+`
+		ORDER BY `+page.OrderBy("p.created_at", "p.id", true)+`
+		LIMIT ?
+	`, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
@@ -131,30 +201,14 @@ func (S *Server) GetAllPosts(targetedUserID, currentUserID int) ([]Post, error)
 	for rows.Next() {
 		var post Post
 		var authorID int
-		var firstName, lastName, nickname, avatar, url sql.NullString
-		var isPrivate, isFollowing bool
+		var firstName, lastName, nickname, avatar, url, editedAt sql.NullString
+		var groupID sql.NullInt64
+		var isPrivate bool
 		if err := rows.Scan(
-			&post.ID, &post.Content, &post.Image, &post.CreatedAt, &post.Privacy,
+			&post.ID, &post.Content, &post.Image, &post.CreatedAt, &editedAt, &post.Privacy, &groupID,
 			&authorID, &firstName, &lastName, &nickname, &avatar, &isPrivate, &url, &post.Comments,
 		); err != nil {
-			return nil, err
-		}
-		if post.Privacy == "almost-private" && authorID != currentUserID {
-			isFollowing, err = S.IsFollowing(currentUserID, "", authorID)
-			if err != nil {
-				return nil, err
-			}
-			if !isFollowing {
-				continue
-			}
-		} else if post.Privacy == "private" {
-			UserAllowed, err := S.UserAllowedToSeePost(currentUserID, post.ID)
-			if err != nil {
-				return nil, err
-			}
-			if authorID != currentUserID && !UserAllowed {
-				continue
-			}
+			return nil, "", err
 		}
 
 		post.Author = Author{
@@ -165,10 +219,22 @@ func (S *Server) GetAllPosts(targetedUserID, currentUserID int) ([]Post, error)
 			Url:       url.String,
 		}
 		post.UserID = authorID
+		post.GroupID = int(groupID.Int64)
+		post.EditedAt = editedAt.String
 		posts = append(posts, post)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	posts, nextCursor := FinishPage(page, posts, true, func(post Post) string {
+		return EncodeCursor(post.ID, post.CreatedAt)
+	})
 
-	return posts, nil
+	if err := S.LoadPostsReactions(posts, currentUserID); err != nil {
+		return nil, "", err
+	}
+	return posts, nextCursor, nil
 }
 
 func (S *Server) GetUserIdFromPostID(postID int) (int, error) {
@@ -186,8 +252,15 @@ func (S *Server) GetPostsHandler(w http.ResponseWriter, r *http.Request) {
 		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+
+	page, err := ParsePage(r)
+	if err != nil {
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var allPosts []Post
-	posts, err := S.GetAllPosts(0, userID)
+	posts, nextCursor, err := S.GetHomeFeed(userID, page)
 	if err != nil {
 		fmt.Println("GetPostsHandler GetUserPosts error : ", err)
 		tools.SendJSONError(w, "DB Error", http.StatusInternalServerError)
@@ -196,18 +269,52 @@ func (S *Server) GetPostsHandler(w http.ResponseWriter, r *http.Request) {
 	allPosts = append(allPosts, posts...)
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"posts": allPosts,
+		"posts":      allPosts,
+		"nextCursor": nextCursor,
 		"user": map[string]interface{}{
 			"userID": userID,
 		},
 	})
 }
 
+// ExplorePostsHandler returns public posts from every account, for discovery
+func (S *Server) ExplorePostsHandler(w http.ResponseWriter, r *http.Request) {
+	banned, userID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	page, err := ParsePage(r)
+	if err != nil {
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	posts, nextCursor, err := S.GetExplorePosts(userID, page)
+	if err != nil {
+		fmt.Println("ExplorePostsHandler error : ", err)
+		tools.SendJSONError(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"posts":      posts,
+		"nextCursor": nextCursor,
+	})
+}
+
+// UserAllowedToSeePost reports whether userID is in the audience of a private post,
+// picked directly or through one of the audience lists it is shared with
 func (S *Server) UserAllowedToSeePost(userID int, postID int) (bool, error) {
-	query := "SELECT id FROM posts_private WHERE post_id = ? AND user_id = ?"
+	query := `
+		SELECT EXISTS(SELECT 1 FROM posts_private pp WHERE pp.post_id = p.id AND pp.user_id = ?)
+			OR ` + audienceMemberSQL + `
+		FROM posts p WHERE p.id = ?`
 
-	var id int
-	err := S.db.QueryRow(query, postID, userID).Scan(&id)
+	var allowed bool
+	err := S.db.QueryRow(query, userID, userID, postID).Scan(&allowed)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return false, nil
@@ -215,13 +322,13 @@ func (S *Server) UserAllowedToSeePost(userID int, postID int) (bool, error) {
 
 		return false, err
 	}
-	return true, nil
+	return allowed, nil
 }
 
 func (S *Server) GetPostFromID(postID int, currentUserID int) (Post, error) {
 	row := S.db.QueryRow(`
 	SELECT 
-		p.id, p.content, p.image, p.created_at, p.privacy, p.group_id,
+		p.id, p.content, p.image, p.created_at, p.edited_at, p.privacy, p.group_id,
 		u.id, u.first_name, u.last_name, u.nickname, u.avatar, u.is_private,
 		(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) as comment_count
 	FROM posts p
@@ -231,12 +338,12 @@ func (S *Server) GetPostFromID(postID int, currentUserID int) (Post, error) {
 
 	var post Post
 	var authorID int
-	var firstName, lastName, nickname, avatar sql.NullString
+	var firstName, lastName, nickname, avatar, editedAt sql.NullString
 	var isPrivate bool
 	var groupID sql.NullInt64
 
 	err := row.Scan(
-		&post.ID, &post.Content, &post.Image, &post.CreatedAt, &post.Privacy, &groupID,
+		&post.ID, &post.Content, &post.Image, &post.CreatedAt, &editedAt, &post.Privacy, &groupID,
 		&authorID, &firstName, &lastName, &nickname, &avatar, &isPrivate,
 		&post.Comments,
 	)
@@ -251,6 +358,24 @@ func (S *Server) GetPostFromID(postID int, currentUserID int) (Post, error) {
 		post.GroupID = int(groupID.Int64)
 	}
 
+	if authorID != currentUserID {
+		blocked, err := S.IsBlocked(authorID, currentUserID)
+		if err != nil {
+			return Post{}, err
+		}
+		if blocked {
+			return Post{}, nil
+		}
+		// suspended users' posts are hidden
+		suspended, err := S.IsSuspended(authorID)
+		if err != nil {
+			return Post{}, err
+		}
+		if suspended {
+			return Post{}, nil
+		}
+	}
+
 	// privacy check
 	if post.Privacy == "almost-private" && authorID != currentUserID {
 		isFollowing, err := S.IsFollowing(currentUserID, "", authorID)
@@ -268,6 +393,11 @@ func (S *Server) GetPostFromID(postID int, currentUserID int) (Post, error) {
 		if authorID != currentUserID && !UserAllowed {
 			return Post{}, nil
 		}
+		if authorID == currentUserID {
+			if post.AudienceLists, err = S.GetPostAudienceLists(post.ID); err != nil {
+				return Post{}, err
+			}
+		}
 	}
 
 	// convert NullString
@@ -278,8 +408,309 @@ func (S *Server) GetPostFromID(postID int, currentUserID int) (Post, error) {
 		IsPrivate: isPrivate,
 	}
 	post.UserID = authorID
+	post.EditedAt = editedAt.String
 	post.Comments = 0
+	if err := S.LoadPostReactions(&post, currentUserID); err != nil {
+		return Post{}, err
+	}
 
 	return post, nil
 
 }
+
+// EditPostHandler lets the author change the content, image, privacy and audience of a post.
+// The replaced version is kept in post_revisions.
+func (S *Server) EditPostHandler(w http.ResponseWriter, r *http.Request) {
+	banned, userID := S.ActionMiddleware(r, http.MethodPut, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var post Post
+	if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
+		tools.SendJSONError(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	var old Post
+	var authorID int
+	var groupID sql.NullInt64
+	err := S.db.QueryRow(`
+		SELECT user_id, content, image, privacy, group_id FROM posts WHERE id = ?
+	`, post.ID).Scan(&authorID, &old.Content, &old.Image, &old.Privacy, &groupID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			tools.SendJSONError(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if authorID != userID {
+		S.RecordStrike(r, userID, "editing another user's post")
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if strings.TrimSpace(post.Content) == "" && post.Image == nil {
+		tools.SendJSONError(w, "Content cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	// group posts have no privacy of their own, they follow the group
+	if groupID.Valid {
+		post.Privacy = old.Privacy
+		post.SelectedFollowers = nil
+	} else if post.Privacy != "public" && post.Privacy != "almost-private" && post.Privacy != "private" {
+		tools.SendJSONError(w, "Invalid privacy setting", http.StatusBadRequest)
+		return
+	}
+
+	var followers []int
+	if post.Privacy == "private" {
+		followers, err = S.CheckPostAudience(userID, post.SelectedFollowers, post.AudienceLists)
+		if err != nil {
+			SendActionError(w, err)
+			return
+		}
+	} else {
+		post.AudienceLists = nil
+	}
+
+	if post.Image != nil {
+		trimmed := strings.TrimPrefix(*post.Image, "/")
+		post.Image = &trimmed
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		tools.SendJSONError(w, "failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO post_revisions (post_id, content, image, privacy)
+		VALUES (?, ?, ?, ?)`,
+		post.ID, old.Content, old.Image, old.Privacy,
+	)
+	if err != nil {
+		fmt.Println("Error saving post revision:", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE posts
+		SET content = ?, image = ?, privacy = ?, edited_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		html.EscapeString(post.Content), post.Image, post.Privacy, post.ID,
+	)
+	if err != nil {
+		fmt.Println("Error updating post:", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := IndexPostHashtags(tx, post.ID, post.Content); err != nil {
+		fmt.Println("Error indexing hashtags:", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := SavePostAudience(tx, post.ID, followers, post.AudienceLists); err != nil {
+		fmt.Println("Error saving post audience:", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		tools.SendJSONError(w, "failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	S.UpdateMentions("post", post.ID, userID, post.Content)
+
+	updated, err := S.GetPostFromID(post.ID, userID)
+	if err != nil {
+		tools.SendJSONError(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeletePostHandler removes a post together with its comments, reactions,
+// revisions and uploaded images, and tells connected clients to drop it
+func (S *Server) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	banned, userID := S.ActionMiddleware(r, http.MethodDelete, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ID := r.URL.Path[len("/api/delete-post/"):]
+	checkPostID, postID := tools.IsNumeric(ID)
+	if !checkPostID {
+		tools.SendJSONError(w, "invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	authorID, err := S.GetUserIdFromPostID(postID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			tools.SendJSONError(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if authorID != userID {
+		S.RecordStrike(r, userID, "deleting another user's post")
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	files, err := S.GetPostFiles(postID)
+	if err != nil {
+		fmt.Println("Error collecting post files:", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// who may see the post can only be told before it is gone
+	viewers := S.PostViewers(postID, authorID)
+
+	if err := S.DeletePost(postID); err != nil {
+		fmt.Println("Error deleting post:", err)
+		tools.SendJSONError(w, "Failed to delete post", http.StatusInternalServerError)
+		return
+	}
+
+	for _, file := range files {
+		if err := RemoveUploadedFile(file); err != nil {
+			fmt.Println("Error removing post file:", err)
+		}
+	}
+
+	S.BroadcastPostDeleted(postID, viewers)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "post deleted"})
+}
+
+// DeletePost deletes a post and every row that depends on it.
+// Rows are removed explicitly since foreign keys are not enforced on every connection.
+func (S *Server) DeletePost(postID int) error {
+	tx, err := S.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM post_reactions WHERE post_id = ?`,
+		`DELETE FROM posts_private WHERE post_id = ?`,
+		`DELETE FROM post_audiences WHERE post_id = ?`,
+		`DELETE FROM post_revisions WHERE post_id = ?`,
+		`DELETE FROM comment_hashtags WHERE post_id = ?`,
+		`DELETE FROM mentions WHERE source = 'comment' AND source_id IN (SELECT id FROM comments WHERE post_id = ?)`,
+		`DELETE FROM mentions WHERE source = 'post' AND source_id = ?`,
+		`DELETE FROM post_hashtags WHERE post_id = ?`,
+		`DELETE FROM comments WHERE post_id = ?`,
+		`DELETE FROM comment_subscriptions WHERE post_id = ?`,
+		`DELETE FROM notifications WHERE reference_id = ? AND type IN ('like', 'reply', 'comment', 'mention')`,
+		`DELETE FROM posts WHERE id = ?`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, postID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetPostFiles lists the uploaded files used by a post, its earlier revisions and its comments
+func (S *Server) GetPostFiles(postID int) ([]string, error) {
+	rows, err := S.db.Query(`
+		SELECT image FROM posts WHERE id = ? AND image IS NOT NULL
+		UNION
+		SELECT image FROM post_revisions WHERE post_id = ? AND image IS NOT NULL
+		UNION
+		SELECT content FROM comments WHERE post_id = ? AND type IN ('image', 'gif')
+	`, postID, postID, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var file string
+		if err := rows.Scan(&file); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// GetPostRevisionsHandler returns the earlier versions of a post, newest first (author only)
+func (S *Server) GetPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	banned, userID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ID := r.URL.Path[len("/api/post-revisions/"):]
+	checkPostID, postID := tools.IsNumeric(ID)
+	if !checkPostID {
+		tools.SendJSONError(w, "invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	authorID, err := S.GetUserIdFromPostID(postID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			tools.SendJSONError(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if authorID != userID {
+		tools.SendJSONError(w, "Only the author can see earlier versions", http.StatusForbidden)
+		return
+	}
+
+	rows, err := S.db.Query(`
+		SELECT id, post_id, content, image, privacy, created_at
+		FROM post_revisions
+		WHERE post_id = ?
+		ORDER BY id DESC
+	`, postID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var revision PostRevision
+		if err := rows.Scan(&revision.ID, &revision.PostID, &revision.Content, &revision.Image, &revision.Privacy, &revision.CreatedAt); err != nil {
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		revisions = append(revisions, revision)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
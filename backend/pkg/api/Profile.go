@@ -29,13 +29,25 @@ func (S *Server) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// blocked users look like they do not exist
+	if blocked, err := S.IsBlocked(targetedUserID, currentUser); err != nil || blocked {
+		tools.SendJSONError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
 	user, err := S.GetUserData("", targetedUserID)
 	if err != nil {
 		tools.SendJSONError(w, "user not found", http.StatusNotFound)
 		return
 	}
 
-	posts, err := S.GetAllPosts(targetedUserID, currentUser)
+	page, err := ParsePage(r)
+	if err != nil {
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	posts, nextCursor, err := S.GetAllPosts(targetedUserID, currentUser, page)
 	if err != nil {
 		fmt.Println(err)
 		tools.SendJSONError(w, "error getting posts", http.StatusInternalServerError)
@@ -77,6 +89,7 @@ func (S *Server) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 
 	resp := map[string]interface{}{
 		"posts":       posts,
+		"nextCursor":  nextCursor,
 		"user":        user,
 		"followers":   user.FollowersCount,
 		"following":   user.FollowingCount,
@@ -104,7 +117,7 @@ func (S *Server) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(user.ID)
 
 	if id != userID {
-		S.ActionMiddleware(r, http.MethodPut, true, true)
+		S.RecordStrike(r, userID, "updating a profile with another user's id")
 		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -117,16 +130,21 @@ func (S *Server) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	if user.Nickname != "" {
 		user.Url = user.Nickname
 	}
+	// the email is changed through /api/change-email, which confirms the new address
 	_, err = S.db.ExecContext(r.Context(), `
         UPDATE users
-        SET first_name = ?, last_name = ?, nickname = ?, email = ?, birthdate = ?, avatar = ?, about_me = ?, is_private = ?, url = ?
+        SET first_name = ?, last_name = ?, nickname = ?, birthdate = ?, avatar = ?, about_me = ?, is_private = ?, url = ?
 		WHERE id = ?
-	`, html.EscapeString(user.FirstName), html.EscapeString(user.LastName), html.EscapeString(user.Nickname), html.EscapeString(user.Email), html.EscapeString(user.DateOfBirth), user.Avatar, html.EscapeString(user.AboutMe), user.IsPrivate, html.EscapeString(user.Url), user.ID,
+	`, html.EscapeString(user.FirstName), html.EscapeString(user.LastName), html.EscapeString(user.Nickname), html.EscapeString(user.DateOfBirth), user.Avatar, html.EscapeString(user.AboutMe), user.IsPrivate, html.EscapeString(user.Url), user.ID,
 	)
 	if err != nil {
 		tools.SendJSONError(w, "Failed to update user", http.StatusInternalServerError)
 		return
 	}
+	if err := S.db.QueryRow(`SELECT email FROM users WHERE id = ?`, id).Scan(&user.Email); err != nil {
+		tools.SendJSONError(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
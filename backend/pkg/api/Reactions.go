@@ -0,0 +1,245 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReactionTypes is the fixed set of reactions a post can receive
+var ReactionTypes = []string{"like", "love", "laugh", "sad"}
+
+func IsValidReaction(reaction string) bool {
+	for _, t := range ReactionTypes {
+		if t == reaction {
+			return true
+		}
+	}
+	return false
+}
+
+// ReactToPostHandler adds the current user's reaction to a post, or changes it if one exists
+func (S *Server) ReactToPostHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var reaction ReactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&reaction); err != nil {
+		tools.SendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !IsValidReaction(reaction.Type) {
+		tools.SendJSONError(w, "Invalid reaction type", http.StatusBadRequest)
+		return
+	}
+
+	authorID, err := S.GetUserIdFromPostID(reaction.PostID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			tools.SendJSONError(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	authorized, err := S.CheckPostPrivacy(reaction.PostID, authorID, currentUserID, "")
+	if err != nil {
+		tools.SendJSONError(w, "Failed to validate post privacy", http.StatusInternalServerError)
+		return
+	}
+	if !authorized {
+		tools.SendJSONError(w, "Unauthorized to react to this post", http.StatusUnauthorized)
+		return
+	}
+
+	previous, err := S.GetUserReaction(reaction.PostID, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = S.db.Exec(`
+		INSERT INTO post_reactions (post_id, user_id, type) VALUES (?, ?, ?)
+		ON CONFLICT(post_id, user_id) DO UPDATE SET type = excluded.type, created_at = CURRENT_TIMESTAMP
+	`, reaction.PostID, currentUserID, reaction.Type)
+	if err != nil {
+		fmt.Println("Error saving reaction:", err)
+		tools.SendJSONError(w, "Failed to save reaction", http.StatusInternalServerError)
+		return
+	}
+
+	// only the first reaction notifies the author, switching type does not
+	if previous == "" && authorID != currentUserID {
+		notification := Notification{
+			ID:          authorID,
+			ActorID:     currentUserID,
+			Type:        "like",
+			Content:     "Reacted to your post",
+			IsRead:      false,
+			CreatedAt:   time.Now(),
+			ReferenceID: reaction.PostID,
+		}
+		if err := S.InsertNotification(notification); err != nil {
+			fmt.Println("Error inserting notification:", err)
+		} else {
+			S.PushNotification("-new", authorID, notification)
+		}
+	}
+
+	S.writeReactionSummary(w, reaction.PostID, currentUserID)
+}
+
+// RemoveReactionHandler removes the current user's reaction from a post
+func (S *Server) RemoveReactionHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodDelete, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ID := r.URL.Path[len("/api/remove-reaction/"):]
+	checkPostID, postID := tools.IsNumeric(ID)
+	if !checkPostID {
+		tools.SendJSONError(w, "invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	authorID, err := S.GetUserIdFromPostID(postID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			tools.SendJSONError(w, "Post not found", http.StatusNotFound)
+			return
+		}
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	authorized, err := S.CheckPostPrivacy(postID, authorID, currentUserID, "")
+	if err != nil {
+		tools.SendJSONError(w, "Failed to validate post privacy", http.StatusInternalServerError)
+		return
+	}
+	if !authorized {
+		tools.SendJSONError(w, "Unauthorized to react to this post", http.StatusUnauthorized)
+		return
+	}
+
+	res, err := S.db.Exec(`DELETE FROM post_reactions WHERE post_id = ? AND user_id = ?`, postID, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Failed to remove reaction", http.StatusInternalServerError)
+		return
+	}
+	if removed, _ := res.RowsAffected(); removed == 0 {
+		tools.SendJSONError(w, "Reaction not found", http.StatusNotFound)
+		return
+	}
+
+	if authorID != currentUserID {
+		S.DeleteReferencedNotification(currentUserID, authorID, "like", postID)
+		S.PushNotification("-delete", authorID, Notification{})
+	}
+
+	S.writeReactionSummary(w, postID, currentUserID)
+}
+
+func (S *Server) writeReactionSummary(w http.ResponseWriter, postID, currentUserID int) {
+	post := Post{ID: postID}
+	if err := S.LoadPostReactions(&post, currentUserID); err != nil {
+		fmt.Println("Error loading reactions:", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// viewers following the post over the socket see the new counts
+	S.PublishTopic("post:"+strconv.Itoa(postID), "reactions-update", map[string]interface{}{
+		"postId":    post.ID,
+		"likes":     post.Likes,
+		"reactions": post.Reactions,
+	}, 0)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"postId":       post.ID,
+		"likes":        post.Likes,
+		"reactions":    post.Reactions,
+		"userReaction": post.UserReaction,
+	})
+}
+
+// LoadPostReactions fills the per-type counts, the total and the viewer's own reaction of a post
+func (S *Server) LoadPostReactions(post *Post, currentUserID int) error {
+	posts := []Post{*post}
+	err := S.LoadPostsReactions(posts, currentUserID)
+	*post = posts[0]
+	return err
+}
+
+// LoadPostsReactions does what LoadPostReactions does for every post of a feed, in one query
+func (S *Server) LoadPostsReactions(posts []Post, currentUserID int) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(posts))
+	placeholders := make([]string, len(posts))
+	args := []interface{}{currentUserID}
+	for i := range posts {
+		posts[i].Reactions = make(map[string]int, len(ReactionTypes))
+		for _, t := range ReactionTypes {
+			posts[i].Reactions[t] = 0
+		}
+		posts[i].Likes = 0
+		posts[i].UserReaction = ""
+		index[posts[i].ID] = i
+		placeholders[i] = "?"
+		args = append(args, posts[i].ID)
+	}
+
+	rows, err := S.db.Query(`
+		SELECT post_id, type, COUNT(*), MAX(user_id = ?) FROM post_reactions
+		WHERE post_id IN (`+strings.Join(placeholders, ", ")+`)
+		GROUP BY post_id, type
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID, count int
+		var reactionType string
+		var own bool
+		if err := rows.Scan(&postID, &reactionType, &count, &own); err != nil {
+			return err
+		}
+		post := &posts[index[postID]]
+		post.Reactions[reactionType] = count
+		post.Likes += count
+		if own {
+			post.UserReaction = reactionType
+		}
+	}
+	return rows.Err()
+}
+
+// GetUserReaction returns the reaction type userID left on postID, or "" if none
+func (S *Server) GetUserReaction(postID, userID int) (string, error) {
+	var reactionType string
+	err := S.db.QueryRow(`SELECT type FROM post_reactions WHERE post_id = ? AND user_id = ?`, postID, userID).Scan(&reactionType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return reactionType, nil
+}
@@ -0,0 +1,219 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// MarkChatReadHandler moves the current user's read position to the latest message of a direct chat
+func (S *Server) MarkChatReadHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPut, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ID := r.URL.Path[len("/api/mark-chat-read/"):]
+	checkChatID, chatID := tools.IsNumeric(ID)
+	if !checkChatID {
+		tools.SendJSONError(w, "invalid chat ID", http.StatusBadRequest)
+		return
+	}
+
+	receipt, err := S.MarkChatRead(currentUserID, chatID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(receipt)
+}
+
+// MarkGroupChatReadHandler moves the current user's read position to the latest message of a group chat
+func (S *Server) MarkGroupChatReadHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPut, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ID := r.URL.Path[len("/api/groups/chat/read/"):]
+	checkGroupID, groupID := tools.IsNumeric(ID)
+	if !checkGroupID {
+		tools.SendJSONError(w, "invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	receipt, err := S.MarkGroupChatRead(currentUserID, groupID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(receipt)
+}
+
+// UnreadCountHandler returns the unread badge counts of the current user
+func (S *Server) UnreadCountHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	direct, groups, err := S.GetUnreadCounts(currentUserID)
+	if err != nil {
+		SendActionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"direct": direct,
+		"groups": groups,
+		"total":  direct + groups,
+	})
+}
+
+// MarkChatRead records that currentUserID has read a direct chat up to its latest message
+// and sends the receipt to every participant
+func (S *Server) MarkChatRead(currentUserID, chatID int) (map[string]interface{}, error) {
+	if !S.CheckIfCaneSendMessage(currentUserID, chatID) {
+		return nil, NewActionError(http.StatusForbidden, "You are not a member of this chat")
+	}
+
+	var lastID int
+	var lastMessageID sql.NullString
+	err := S.db.QueryRow(`
+		SELECT backend_id, id FROM messages WHERE chat_id = ? ORDER BY backend_id DESC LIMIT 1
+	`, chatID).Scan(&lastID, &lastMessageID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	_, err = S.db.Exec(`
+		INSERT INTO chat_reads (chat_id, user_id, last_read_id) VALUES (?, ?, ?)
+		ON CONFLICT(chat_id, user_id) DO UPDATE SET
+			last_read_id = MAX(last_read_id, excluded.last_read_id),
+			read_at = CURRENT_TIMESTAMP
+	`, chatID, currentUserID, lastID)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := map[string]interface{}{
+		"chatId":        chatID,
+		"userId":        currentUserID,
+		"lastMessageId": lastMessageID.String,
+		"readAt":        time.Now().UTC().Format(time.RFC3339),
+	}
+
+	participants, _ := S.GetChatParticipantIDs(chatID)
+	for _, userID := range participants {
+		S.PushChatEvent("chat-read", userID, receipt)
+	}
+	return receipt, nil
+}
+
+// MarkGroupChatRead records that currentUserID has read a group chat up to its latest message
+// and sends the receipt to the group's members
+func (S *Server) MarkGroupChatRead(currentUserID, groupID int) (map[string]interface{}, error) {
+	member, err := S.IsGroupMember(groupID, currentUserID)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, NewActionError(http.StatusForbidden, "Not a member")
+	}
+
+	var lastID int
+	err = S.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM group_messages WHERE group_id = ?`, groupID).Scan(&lastID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = S.db.Exec(`
+		INSERT INTO group_chat_reads (group_id, user_id, last_read_id) VALUES (?, ?, ?)
+		ON CONFLICT(group_id, user_id) DO UPDATE SET
+			last_read_id = MAX(last_read_id, excluded.last_read_id),
+			read_at = CURRENT_TIMESTAMP
+	`, groupID, currentUserID, lastID)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := map[string]interface{}{
+		"groupId":       groupID,
+		"userId":        currentUserID,
+		"lastMessageId": lastID,
+		"readAt":        time.Now().UTC().Format(time.RFC3339),
+	}
+
+	rows, err := S.db.Query(`SELECT user_id FROM group_members WHERE group_id = ?`, groupID)
+	if err != nil {
+		return receipt, nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var memberID int
+		if err := rows.Scan(&memberID); err != nil {
+			continue
+		}
+		S.PushChatEvent("group-chat-read", memberID, receipt)
+	}
+	return receipt, nil
+}
+
+// chatUnreadSQL counts the messages of chat c that user ? has not read yet.
+// It takes the user three times. Messages from senders they muted in chat never count.
+const chatUnreadSQL = `(
+	SELECT COUNT(*) FROM messages m
+	WHERE m.chat_id = c.id AND m.sender_id != ? AND m.is_deleted = 0
+	AND m.backend_id > COALESCE((SELECT r.last_read_id FROM chat_reads r WHERE r.chat_id = c.id AND r.user_id = ?), 0)
+	AND NOT EXISTS (
+		SELECT 1 FROM mutes mu WHERE mu.user_id = ? AND mu.muted_id = m.sender_id AND mu.chat = 1 AND ` + muteActiveSQL + `)
+)`
+
+// groupUnreadSQL counts the messages of group g that member ? has not read yet.
+// Messages from before the member joined or from senders they muted in chat never count.
+const groupUnreadSQL = `(
+	SELECT COUNT(*) FROM group_messages m
+	JOIN group_members gm ON gm.group_id = m.group_id AND gm.user_id = ?
+	WHERE m.group_id = g.id AND m.sender_id != gm.user_id AND m.created_at >= gm.joined_at AND m.is_deleted = 0
+	AND m.id > COALESCE((SELECT r.last_read_id FROM group_chat_reads r WHERE r.group_id = g.id AND r.user_id = gm.user_id), 0)
+	AND NOT EXISTS (
+		SELECT 1 FROM mutes mu WHERE mu.user_id = gm.user_id AND mu.muted_id = m.sender_id AND mu.chat = 1 AND ` + muteActiveSQL + `)
+)`
+
+// GetUnreadCounts returns how many messages currentUserID has not read in direct chats and in group chats
+func (S *Server) GetUnreadCounts(currentUserID int) (int, int, error) {
+	var direct, groups int
+	err := S.db.QueryRow(`
+		SELECT COALESCE(SUM(`+chatUnreadSQL+`), 0) FROM chats c
+		WHERE EXISTS (SELECT 1 FROM chat_participants p WHERE p.chat_id = c.id AND p.user_id = ?)
+	`, currentUserID, currentUserID, currentUserID, currentUserID).Scan(&direct)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = S.db.QueryRow(`
+		SELECT COALESCE(SUM(`+groupUnreadSQL+`), 0) FROM groups g
+		WHERE EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = g.id AND gm.user_id = ?)
+	`, currentUserID, currentUserID).Scan(&groups)
+	if err != nil {
+		return 0, 0, err
+	}
+	return direct, groups, nil
+}
+
+// GetGroupUnreadCount returns how many messages of a group chat currentUserID has not read
+func (S *Server) GetGroupUnreadCount(groupID, currentUserID int) (int, error) {
+	var count int
+	err := S.db.QueryRow(`SELECT `+groupUnreadSQL+` FROM groups g WHERE g.id = ?`, currentUserID, groupID).Scan(&count)
+	return count, err
+}
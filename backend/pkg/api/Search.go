@@ -0,0 +1,209 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxSearchTerms caps how many words of a query are matched
+const MaxSearchTerms = 8
+
+// The search index holds unescaped text, so matches are highlighted with these markers,
+// the snippet is HTML-escaped and only then are the markers turned into <mark> tags
+const (
+	searchMarkOpen  = "\x02"
+	searchMarkClose = "\x03"
+)
+
+// searchSnippet are the snippet() arguments after the column
+const searchSnippet = `'` + searchMarkOpen + `', '` + searchMarkClose + `', '…', 12`
+
+var searchMarks = strings.NewReplacer(searchMarkOpen, "<mark>", searchMarkClose, "</mark>")
+
+// searchMarkup escapes highlighted index text so it can be rendered as HTML
+func searchMarkup(text string) string {
+	return searchMarks.Replace(html.EscapeString(text))
+}
+
+// SearchKinds are the values accepted by the type parameter of /api/search
+var SearchKinds = []string{"posts", "comments", "users", "groups"}
+
+// SearchHandler runs a ranked full-text search over what the current user is allowed to see.
+// ?q= is required, ?type= narrows it to one kind and enables paging with ?offset=.
+func (S *Server) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	match := SearchMatchQuery(r.URL.Query().Get("q"))
+	if match == "" {
+		tools.SendJSONError(w, "search query is required", http.StatusBadRequest)
+		return
+	}
+
+	page, err := ParsePage(r)
+	if err != nil {
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		offset, err = strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			tools.SendJSONError(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	kinds := SearchKinds
+	if kind := r.URL.Query().Get("type"); kind != "" && kind != "all" {
+		valid := false
+		for _, k := range SearchKinds {
+			valid = valid || k == kind
+		}
+		if !valid {
+			tools.SendJSONError(w, "type must be one of posts, comments, users, groups or all", http.StatusBadRequest)
+			return
+		}
+		kinds = []string{kind}
+	} else if offset != 0 {
+		tools.SendJSONError(w, "offset needs a type", http.StatusBadRequest)
+		return
+	}
+
+	result := map[string]interface{}{}
+	for _, kind := range kinds {
+		hits, err := S.Search(kind, match, currentUserID, page.Limit+1, offset)
+		if err != nil {
+			fmt.Println("Search Error : ", err)
+			tools.SendJSONError(w, "search failed", http.StatusInternalServerError)
+			return
+		}
+		if len(kinds) == 1 {
+			nextOffset := 0
+			if len(hits) > page.Limit {
+				nextOffset = offset + page.Limit
+			}
+			result["nextOffset"] = nextOffset
+		}
+		if len(hits) > page.Limit {
+			hits = hits[:page.Limit]
+		}
+		result[kind] = hits
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// SearchMatchQuery turns free text into an FTS5 query: every word must match, as a prefix.
+// Words are quoted, so operators typed by the user are never interpreted.
+func SearchMatchQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) > MaxSearchTerms {
+		words = words[:MaxSearchTerms]
+	}
+	for i, word := range words {
+		words[i] = `"` + word + `"*`
+	}
+	return strings.Join(words, " ")
+}
+
+// Search returns up to limit hits of one kind, best first, that viewerID may see
+func (S *Server) Search(kind, match string, viewerID, limit, offset int) ([]SearchHit, error) {
+	var query string
+	var args []interface{}
+
+	switch kind {
+	case "posts":
+		visible, visibleArgs := PostVisibleCondition(viewerID)
+		query = `
+		SELECT p.id, 0, COALESCE(p.group_id, 0), '', snippet(posts_fts, 0, ` + searchSnippet + `), p.created_at,
+			u.id, u.first_name || ' ' || u.last_name, u.nickname, COALESCE(u.avatar, ''), u.url
+		FROM posts_fts
+		JOIN posts p ON p.id = posts_fts.rowid
+		JOIN users u ON u.id = p.user_id
+		WHERE posts_fts MATCH ? AND ` + visible + `
+		ORDER BY bm25(posts_fts)`
+		args = append([]interface{}{match}, visibleArgs...)
+
+	case "comments":
+		visible, visibleArgs := PostVisibleCondition(viewerID)
+		notBlocked, notBlockedArgs := NotBlockedCondition("c.user_id", viewerID)
+		query = `
+		SELECT c.id, c.post_id, COALESCE(p.group_id, 0), '', snippet(comments_fts, 0, ` + searchSnippet + `), c.created_at,
+			u.id, u.first_name || ' ' || u.last_name, u.nickname, COALESCE(u.avatar, ''), u.url
+		FROM comments_fts
+		JOIN comments c ON c.id = comments_fts.rowid
+		JOIN posts p ON p.id = c.post_id
+		JOIN users u ON u.id = c.user_id
+		WHERE comments_fts MATCH ? AND ` + visible + ` AND ` + notBlocked + `
+		ORDER BY bm25(comments_fts)`
+		args = append(append([]interface{}{match}, visibleArgs...), notBlockedArgs...)
+
+	case "users":
+		notBlocked, notBlockedArgs := NotBlockedCondition("u.id", viewerID)
+		// names weigh more than nicknames
+		query = `
+		SELECT u.id, 0, 0, '', snippet(users_fts, -1, ` + searchSnippet + `), u.created_at,
+			u.id, u.first_name || ' ' || u.last_name, u.nickname, COALESCE(u.avatar, ''), u.url
+		FROM users_fts
+		JOIN users u ON u.id = users_fts.rowid
+		WHERE users_fts MATCH ? AND ` + notBlocked + `
+		ORDER BY bm25(users_fts, 2.0, 2.0, 1.0)`
+		args = append([]interface{}{match}, notBlockedArgs...)
+
+	case "groups":
+		// private groups are only found by their members
+		query = `
+		SELECT g.id, 0, g.id, highlight(groups_fts, 0, '` + searchMarkOpen + `', '` + searchMarkClose + `'), snippet(groups_fts, 1, ` + searchSnippet + `), g.created_at,
+			0, '', NULL, '', ''
+		FROM groups_fts
+		JOIN groups g ON g.id = groups_fts.rowid
+		WHERE groups_fts MATCH ? AND (
+			g.privacy = 'public'
+			OR EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = g.id AND gm.user_id = ?))
+		ORDER BY bm25(groups_fts, 3.0, 1.0)`
+		args = []interface{}{match, viewerID}
+
+	default:
+		return nil, fmt.Errorf("unknown search kind %q", kind)
+	}
+
+	rows, err := S.db.Query(query+` LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+	for rows.Next() {
+		var hit SearchHit
+		var user SearchUser
+		var nickname sql.NullString
+		if err := rows.Scan(&hit.ID, &hit.PostID, &hit.GroupID, &hit.Title, &hit.Snippet, &hit.CreatedAt,
+			&user.ID, &user.Name, &nickname, &user.Avatar, &user.Url); err != nil {
+			return nil, err
+		}
+		hit.Title = searchMarkup(hit.Title)
+		hit.Snippet = searchMarkup(hit.Snippet)
+		if user.ID != 0 {
+			user.Username = nickname.String
+			hit.User = &user
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
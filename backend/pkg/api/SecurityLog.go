@@ -0,0 +1,155 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// security log events
+const (
+	SecurityLoginFailed         = "login_failed"
+	SecurityTwoFactorFailed     = "two_factor_failed"
+	SecurityLoginLocked         = "login_locked"
+	SecurityPasswordCheckFailed = "password_check_failed"
+	SecurityTwoFactorDisabled   = "two_factor_disabled"
+	SecurityStrike              = "strike"
+	SecurityStrikeSuspended     = "strike_suspended"
+)
+
+// SecurityLogLimit is how many events GetSecurityLogHandler returns, and SecurityLogRetention
+// how long they are kept
+const SecurityLogLimit = 100
+
+var SecurityLogRetention = 90 * 24 * time.Hour
+
+// GetSecurityLogHandler lists the current user's latest security events, newest first
+func (S *Server) GetSecurityLogHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := S.db.Query(`
+		SELECT id, user_id, event, ip, user_agent, endpoint, reason, created_at
+		FROM security_events
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, currentUserID, SecurityLogLimit)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	events := []SecurityEvent{}
+	for rows.Next() {
+		event, err := scanSecurityEvent(rows)
+		if err != nil {
+			fmt.Println("Get Security Log Error : ", err)
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		events = append(events, event)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// GetSecurityEventsHandler pages through every user's security events for moderators,
+// newest first. ?userId= and ?event= narrow the list down.
+func (S *Server) GetSecurityEventsHandler(w http.ResponseWriter, r *http.Request) {
+	banned, _ := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	page, err := ParsePage(r)
+	if err != nil {
+		tools.SendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	condition, args := page.Condition("created_at", "id")
+	query := r.URL.Query()
+	if userID := query.Get("userId"); userID != "" {
+		id, err := strconv.Atoi(userID)
+		if err != nil {
+			tools.SendJSONError(w, "invalid userId", http.StatusBadRequest)
+			return
+		}
+		condition += " AND user_id = ?"
+		args = append(args, id)
+	}
+	if event := query.Get("event"); event != "" {
+		condition += " AND event = ?"
+		args = append(args, event)
+	}
+
+	rows, err := S.db.Query(`
+		SELECT id, user_id, event, ip, user_agent, endpoint, reason, created_at
+		FROM security_events
+		WHERE `+condition+`
+		ORDER BY `+page.OrderBy("created_at", "id", true)+`
+		LIMIT ?
+	`, append(args, page.Limit+1)...)
+	if err != nil {
+		fmt.Println("Get Security Events Error : ", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	events := []SecurityEvent{}
+	for rows.Next() {
+		event, err := scanSecurityEvent(rows)
+		if err != nil {
+			fmt.Println("Get Security Events Error : ", err)
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		events = append(events, event)
+	}
+	events, nextCursor := FinishPage(page, events, true, func(event SecurityEvent) string {
+		return EncodeCursor(event.ID, event.CreatedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events":     events,
+		"nextCursor": nextCursor,
+	})
+}
+
+// LogSecurityEvent adds event, made by the client of r, to userID's security log, or to no
+// one's when userID is 0. reason says more about it, when there is more to say.
+func (S *Server) LogSecurityEvent(r *http.Request, userID int, event, reason string) {
+	var userValue interface{}
+	if userID != 0 {
+		userValue = userID
+	}
+	_, err := S.db.Exec(`
+		INSERT INTO security_events (user_id, event, ip, user_agent, endpoint, reason)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userValue, event, clientIP(r), userAgent(r), r.Method+" "+r.URL.Path, reason)
+	if err != nil {
+		fmt.Println("Log Security Event Error : ", err)
+	}
+}
+
+func scanSecurityEvent(rows *sql.Rows) (SecurityEvent, error) {
+	var event SecurityEvent
+	var userID sql.NullInt64
+	var createdAt sql.NullTime
+	err := rows.Scan(&event.ID, &userID, &event.Event, &event.IP, &event.UserAgent, &event.Endpoint, &event.Reason, &createdAt)
+	event.UserID = int(userID.Int64)
+	event.CreatedAt = formatNullTime(createdAt)
+	return event, err
+}
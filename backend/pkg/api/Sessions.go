@@ -0,0 +1,249 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// how long sessions last: SessionTTL from login, RememberSessionTTL from the last use of a
+// "remember me" session
+var (
+	SessionTTL         = 24 * time.Hour
+	RememberSessionTTL = 30 * 24 * time.Hour
+)
+
+// SessionSweepInterval is how often expired sessions are deleted
+var SessionSweepInterval = time.Hour
+
+// sessionTouchInterval limits how often a session's last-seen time is written
+const sessionTouchInterval = time.Minute
+
+// GetSessionsHandler lists the current user's active sessions, most recently used first
+func (S *Server) GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	_, currentSessionID, _ := S.CheckSession(r)
+
+	rows, err := S.db.Query(`
+		SELECT session_id, user_agent, ip, created_at, last_seen_at, expires_at, remember
+		FROM sessions
+		WHERE user_id = ? AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_seen_at DESC
+	`, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		var sessionID string
+		var createdAt, lastSeenAt, expiresAt sql.NullTime
+		if err := rows.Scan(&sessionID, &session.UserAgent, &session.IP, &createdAt, &lastSeenAt, &expiresAt, &session.Remember); err != nil {
+			fmt.Println("Get Sessions Error : ", err)
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		session.CreatedAt = formatNullTime(createdAt)
+		session.LastSeenAt = formatNullTime(lastSeenAt)
+		session.ExpiresAt = formatNullTime(expiresAt)
+		session.ID = sessionPublicID(sessionID)
+		session.Current = sessionID == currentSessionID
+		sessions = append(sessions, session)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSessionHandler logs out one of the current user's sessions, by the id GetSessionsHandler gives.
+// Revoking the current session also clears its cookie.
+func (S *Server) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	_, currentSessionID, _ := S.CheckSession(r)
+
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := S.db.Query(`SELECT session_id FROM sessions WHERE user_id = ?`, currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	var target string
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err == nil && body.ID != "" && sessionPublicID(sessionID) == body.ID {
+			target = sessionID
+		}
+	}
+	rows.Close()
+	if target == "" {
+		tools.SendJSONError(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := S.db.Exec(`DELETE FROM sessions WHERE session_id = ?`, target); err != nil {
+		tools.SendJSONError(w, "failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	S.DisconnectRevokedClients(currentUserID)
+
+	if target == currentSessionID {
+		setSessionCookie(w, "", time.Unix(0, 0), true)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "session revoked"})
+}
+
+// RevokeOtherSessionsHandler logs the current user out everywhere but the current session
+func (S *Server) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	_, currentSessionID, _ := S.CheckSession(r)
+
+	res, err := S.db.Exec(`DELETE FROM sessions WHERE user_id = ? AND session_id != ?`, currentUserID, currentSessionID)
+	if err != nil {
+		tools.SendJSONError(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	revoked, _ := res.RowsAffected()
+	S.DisconnectRevokedClients(currentUserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "sessions revoked", "revoked": revoked})
+}
+
+// TouchSession records that a session is in use, at most once per sessionTouchInterval.
+// A remembered session is extended to RememberSessionTTL from now and its cookie renewed.
+func (S *Server) TouchSession(w http.ResponseWriter, sessionID string) {
+	now := time.Now().UTC()
+	expires := now.Add(RememberSessionTTL)
+	res, err := S.db.Exec(`
+		UPDATE sessions
+		SET last_seen_at = CURRENT_TIMESTAMP,
+			expires_at = CASE WHEN remember THEN ? ELSE expires_at END
+		WHERE session_id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)
+	`, expires.Format("2006-01-02 15:04:05"), sessionID, now.Add(-sessionTouchInterval).Format("2006-01-02 15:04:05"))
+	if err != nil {
+		fmt.Println("Touch Session Error : ", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+
+	var remember bool
+	if err := S.db.QueryRow(`SELECT remember FROM sessions WHERE session_id = ?`, sessionID).Scan(&remember); err == nil && remember {
+		setSessionCookie(w, sessionID, expires, true)
+	}
+}
+
+// DisconnectRevokedClients closes userID's WebSocket connections whose session no longer exists.
+// Their reader then removes them from Server.Users.
+func (S *Server) DisconnectRevokedClients(userID int) {
+	S.RLock()
+	clients := append([]*Client{}, S.Users[userID]...)
+	S.RUnlock()
+
+	for _, client := range clients {
+		if _, err := S.SessionUserID(client.SessionID); err != nil {
+			client.Close()
+		}
+	}
+}
+
+// RunSessionSweeper deletes expired sessions now and then every interval, and disconnects the
+// WebSocket clients that were using them. It never returns.
+func (S *Server) RunSessionSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := S.SweepSessions(); err != nil {
+			fmt.Println("Session Sweeper Error : ", err)
+		}
+		<-ticker.C
+	}
+}
+
+// SweepSessions deletes expired sessions and two-factor login challenges, forgotten login
+// failures and old security log events
+func (S *Server) SweepSessions() error {
+	now := time.Now().UTC()
+	for _, q := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{`DELETE FROM sessions WHERE expires_at <= CURRENT_TIMESTAMP`, nil},
+		{`DELETE FROM login_challenges WHERE expires_at <= CURRENT_TIMESTAMP`, nil},
+		{`DELETE FROM login_throttles WHERE last_failure_at < ? AND (locked_until IS NULL OR locked_until <= ?)`,
+			[]interface{}{now.Add(-LoginFailureWindow).Format("2006-01-02 15:04:05"), now.Format("2006-01-02 15:04:05")}},
+		{`DELETE FROM security_events WHERE created_at < ?`, []interface{}{now.Add(-SecurityLogRetention).Format("2006-01-02 15:04:05")}},
+	} {
+		if _, err := S.db.Exec(q.query, q.args...); err != nil {
+			return err
+		}
+	}
+
+	S.RLock()
+	userIDs := make([]int, 0, len(S.Users))
+	for userID := range S.Users {
+		userIDs = append(userIDs, userID)
+	}
+	S.RUnlock()
+	for _, userID := range userIDs {
+		S.DisconnectRevokedClients(userID)
+	}
+	return nil
+}
+
+func formatNullTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.UTC().Format(time.RFC3339)
+}
+
+// sessionPublicID identifies a session in the API; the session id itself is the cookie value
+func sessionPublicID(sessionID string) string {
+	return hashToken(sessionID)[:16]
+}
+
+func userAgent(r *http.Request) string {
+	agent := r.UserAgent()
+	if len(agent) > 255 {
+		agent = agent[:255]
+	}
+	return agent
+}
+
+// clientIP is the address the request came from. Forwarding headers are not trusted.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,62 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// StrikeLimit strikes within StrikeWindow get an account suspended automatically, for
+// StrikeSuspension the first time and twice as long each time after, up to
+// StrikeMaxSuspension. A StrikeLimit of 0 only records strikes.
+var (
+	StrikeLimit         = 5
+	StrikeWindow        = time.Hour
+	StrikeSuspension    = 24 * time.Hour
+	StrikeMaxSuspension = 30 * 24 * time.Hour
+)
+
+// StrikeSuspensionReason is the reason shown to automatically suspended users
+const StrikeSuspensionReason = "Automatic suspension: repeated forged requests"
+
+// RecordStrike writes a strike against userID for a request no honest client sends, such as
+// one naming another user's id, and suspends the account once it has StrikeLimit of them.
+// Strikes made before the account's last suspension do not count again. Moderators are
+// never suspended. A strike without a session (userID 0) is only logged, with its IP.
+func (S *Server) RecordStrike(r *http.Request, userID int, reason string) {
+	S.LogSecurityEvent(r, userID, SecurityStrike, reason)
+	if userID == 0 || StrikeLimit == 0 {
+		return
+	}
+
+	var strikes int
+	var moderator bool
+	err := S.db.QueryRow(`
+		SELECT u.is_moderator, (
+			SELECT COUNT(*) FROM security_events se
+			WHERE se.user_id = u.id AND se.event = ? AND se.created_at >= ?
+			  AND (u.blocked_at IS NULL OR se.created_at > u.blocked_at)
+		)
+		FROM users u
+		WHERE u.id = ?
+	`, SecurityStrike, time.Now().UTC().Add(-StrikeWindow).Format("2006-01-02 15:04:05"), userID).Scan(&moderator, &strikes)
+	if err != nil {
+		fmt.Println("Record Strike Error : ", err)
+		return
+	}
+	if moderator || strikes < StrikeLimit {
+		return
+	}
+
+	// repeat offenders are suspended for longer, as long as the log remembers them
+	var earlier int
+	if err := S.db.QueryRow(`SELECT COUNT(*) FROM security_events WHERE user_id = ? AND event = ?`, userID, SecurityStrikeSuspended).Scan(&earlier); err != nil {
+		fmt.Println("Record Strike Error : ", err)
+		return
+	}
+	if err := S.SuspendUser(userID, 0, StrikeSuspensionReason, time.Now().Add(doubledCapped(StrikeSuspension, StrikeMaxSuspension, earlier))); err != nil {
+		fmt.Println("Record Strike Error : ", err)
+		return
+	}
+	S.LogSecurityEvent(r, userID, SecurityStrikeSuspended, fmt.Sprintf("%d strikes within %s", strikes, StrikeWindow))
+}
@@ -0,0 +1,490 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// limits on the texts of a suspension and its appeal
+const (
+	MaxSuspensionReason = 500
+	MaxAppealMessage    = 2000
+)
+
+// appeal statuses
+const (
+	AppealPending  = "pending"
+	AppealAccepted = "accepted"
+	AppealRejected = "rejected"
+)
+
+// suspensionSelectSQL reads a Suspension with scanSuspension from users u, with the appeal of
+// the current suspension if there is one
+const suspensionSelectSQL = `
+	SELECT u.id, COALESCE(u.nickname, ''), u.blocked_reason, u.blocked_until, u.blocked_at, u.blocked_by,
+		a.id, a.message, a.status, a.response, a.created_at, a.decided_at
+	FROM users u
+	LEFT JOIN suspension_appeals a ON a.user_id = u.id AND a.blocked_at = u.blocked_at
+`
+
+// suspendedSQL returns the SQL condition under which the user in column is suspended.
+// A suspension is over once its blocked_until has passed.
+func suspendedSQL(column string) string {
+	return `EXISTS (
+		SELECT 1 FROM users su
+		WHERE su.id = ` + column + ` AND su.is_blocked = 1
+		  AND (su.blocked_until IS NULL OR su.blocked_until > CURRENT_TIMESTAMP)
+	)`
+}
+
+// NotSuspendedCondition returns the SQL condition under which the user in column is not
+// suspended. Feeds use it to hide suspended users' posts.
+func NotSuspendedCondition(column string) string {
+	return `NOT ` + suspendedSQL(column)
+}
+
+// IsSuspended reports whether userID is currently suspended
+func (S *Server) IsSuspended(userID int) (bool, error) {
+	var suspended bool
+	err := S.db.QueryRow(`SELECT `+suspendedSQL("?"), userID).Scan(&suspended)
+	return suspended, err
+}
+
+// SuspendUserHandler lets a moderator suspend an account, until a time or until lifted.
+// The user is logged out everywhere at once.
+func (S *Server) SuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		UserID int    `json:"userId"`
+		Reason string `json:"reason"`
+		Until  string `json:"until"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if body.UserID == currentUserID {
+		tools.SendJSONError(w, "cannot suspend yourself", http.StatusBadRequest)
+		return
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" || len(reason) > MaxSuspensionReason {
+		tools.SendJSONError(w, fmt.Sprintf("reason must be 1 to %d characters", MaxSuspensionReason), http.StatusBadRequest)
+		return
+	}
+	var until time.Time
+	if body.Until != "" {
+		var err error
+		until, err = time.Parse(time.RFC3339, body.Until)
+		if err != nil || !until.After(time.Now()) {
+			tools.SendJSONError(w, "until must be a future RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var moderator bool
+	err := S.db.QueryRow(`SELECT is_moderator FROM users WHERE id = ?`, body.UserID).Scan(&moderator)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if moderator {
+		tools.SendJSONError(w, "moderators cannot be suspended", http.StatusForbidden)
+		return
+	}
+
+	if err := S.SuspendUser(body.UserID, currentUserID, html.EscapeString(reason), until); err != nil {
+		fmt.Println("Suspend User Error : ", err)
+		tools.SendJSONError(w, "failed to suspend user", http.StatusInternalServerError)
+		return
+	}
+	suspension, err := S.GetSuspension(body.UserID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suspension)
+}
+
+// UnsuspendUserHandler lets a moderator lift a suspension before it ends
+func (S *Server) UnsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	banned, _ := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		UserID int `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	suspension, err := S.GetSuspension(body.UserID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if suspension == nil {
+		tools.SendJSONError(w, "user is not suspended", http.StatusBadRequest)
+		return
+	}
+	if err := S.LiftSuspension(body.UserID); err != nil {
+		fmt.Println("Unsuspend User Error : ", err)
+		tools.SendJSONError(w, "failed to lift suspension", http.StatusInternalServerError)
+		return
+	}
+	S.mailUser(body.UserID, "Your account is no longer suspended",
+		"The suspension of your account was lifted. You can log in again at "+AppURL)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"userId": body.UserID, "suspended": false})
+}
+
+// GetSuspensionsHandler lists the suspended accounts for moderators, with the appeals
+// waiting for a decision first. ?appeal=pending|accepted|rejected|none keeps only the
+// suspensions in that appeal state.
+func (S *Server) GetSuspensionsHandler(w http.ResponseWriter, r *http.Request) {
+	banned, _ := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	condition := "1 = 1"
+	args := []interface{}{}
+	switch appeal := r.URL.Query().Get("appeal"); appeal {
+	case "":
+	case "none":
+		condition = "a.id IS NULL"
+	case AppealPending, AppealAccepted, AppealRejected:
+		condition = "a.status = ?"
+		args = append(args, appeal)
+	default:
+		tools.SendJSONError(w, "invalid appeal filter", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := S.db.Query(suspensionSelectSQL+`
+		WHERE `+suspendedSQL("u.id")+` AND `+condition+`
+		ORDER BY a.status = 'pending' DESC, COALESCE(a.created_at, u.blocked_at)
+	`, args...)
+	if err != nil {
+		fmt.Println("Get Suspensions Error : ", err)
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	suspensions := []Suspension{}
+	for rows.Next() {
+		suspension, err := scanSuspension(rows)
+		if err != nil {
+			fmt.Println("Get Suspensions Error : ", err)
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		suspensions = append(suspensions, suspension)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suspensions)
+}
+
+// DecideAppealHandler lets a moderator accept an appeal, which lifts the suspension, or reject it
+func (S *Server) DecideAppealHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		AppealID int    `json:"appealId"`
+		Accept   bool   `json:"accept"`
+		Response string `json:"response"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	response := strings.TrimSpace(body.Response)
+	if len(response) > MaxAppealMessage {
+		tools.SendJSONError(w, fmt.Sprintf("response must be at most %d characters", MaxAppealMessage), http.StatusBadRequest)
+		return
+	}
+	status := AppealRejected
+	if body.Accept {
+		status = AppealAccepted
+	}
+
+	var userID int
+	var current string
+	var ofCurrentSuspension bool
+	err := S.db.QueryRow(`
+		SELECT a.user_id, a.status, a.blocked_at = u.blocked_at
+		FROM suspension_appeals a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.id = ?
+	`, body.AppealID).Scan(&userID, &current, &ofCurrentSuspension)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "appeal not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if current != AppealPending {
+		tools.SendJSONError(w, "appeal already decided", http.StatusConflict)
+		return
+	}
+
+	_, err = S.db.Exec(`
+		UPDATE suspension_appeals
+		SET status = ?, response = ?, decided_at = CURRENT_TIMESTAMP, decided_by = ?
+		WHERE id = ?
+	`, status, html.EscapeString(response), currentUserID, body.AppealID)
+	if err != nil {
+		fmt.Println("Decide Appeal Error : ", err)
+		tools.SendJSONError(w, "failed to decide appeal", http.StatusInternalServerError)
+		return
+	}
+	if body.Accept {
+		// the appeal of a suspension that since ended must not lift a newer one
+		if ofCurrentSuspension {
+			if err := S.LiftSuspension(userID); err != nil {
+				fmt.Println("Decide Appeal Error : ", err)
+				tools.SendJSONError(w, "failed to lift suspension", http.StatusInternalServerError)
+				return
+			}
+		}
+		S.mailUser(userID, "Your appeal was accepted",
+			"Your appeal was accepted. You can log in again at "+AppURL+"\n\n"+response)
+	} else {
+		S.mailUser(userID, "Your appeal was rejected", "Your account stays suspended.\n\n"+response)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"appealId": body.AppealID, "status": status})
+}
+
+// AppealSuspensionHandler lets a suspended user appeal, once per suspension. A suspended user
+// has no session, so the request carries the same identifier and password as a login.
+func (S *Server) AppealSuspensionHandler(w http.ResponseWriter, r *http.Request) {
+	banned, _ := S.ActionMiddleware(r, http.MethodPost, false, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Identifier string `json:"identifier"`
+		Password   string `json:"password"`
+		Message    string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	message := strings.TrimSpace(body.Message)
+	if message == "" || len(message) > MaxAppealMessage {
+		tools.SendJSONError(w, fmt.Sprintf("message must be 1 to %d characters", MaxAppealMessage), http.StatusBadRequest)
+		return
+	}
+
+	_, userID, _, ok := S.CheckLoginPassword(w, r, body.Identifier, body.Password)
+	if !ok {
+		return
+	}
+	suspension, err := S.GetSuspension(userID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if suspension == nil {
+		tools.SendJSONError(w, "account is not suspended", http.StatusBadRequest)
+		return
+	}
+	if suspension.Appeal != nil {
+		tools.SendJSONError(w, "this suspension was already appealed", http.StatusConflict)
+		return
+	}
+
+	_, err = S.db.Exec(`
+		INSERT INTO suspension_appeals (user_id, blocked_at, message)
+		SELECT id, blocked_at, ? FROM users WHERE id = ?
+	`, html.EscapeString(message), userID)
+	if err != nil {
+		fmt.Println("Appeal Suspension Error : ", err)
+		tools.SendJSONError(w, "failed to send appeal", http.StatusInternalServerError)
+		return
+	}
+	suspension, err = S.GetSuspension(userID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(suspension)
+}
+
+// ModeratorMiddleware is AuthMiddleware for moderation endpoints
+func (S *Server) ModeratorMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return S.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		userID, _, _ := S.CheckSession(r)
+		var moderator bool
+		if err := S.db.QueryRow(`SELECT is_moderator FROM users WHERE id = ?`, userID).Scan(&moderator); err != nil {
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !moderator {
+			tools.SendJSONError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SuspendUser suspends userID until until, or until lifted when it is zero, and ends their
+// sessions and WebSocket connections. moderatorID is 0 for an automatic suspension.
+func (S *Server) SuspendUser(userID, moderatorID int, reason string, until time.Time) error {
+	var untilValue, moderatorValue interface{}
+	if !until.IsZero() {
+		untilValue = until.UTC().Format("2006-01-02 15:04:05")
+	}
+	if moderatorID != 0 {
+		moderatorValue = moderatorID
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	queries := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE users
+			SET is_blocked = 1, blocked_reason = ?, blocked_until = ?, blocked_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), blocked_by = ?
+			WHERE id = ?`, []interface{}{reason, untilValue, moderatorValue, userID}},
+		{`DELETE FROM sessions WHERE user_id = ?`, []interface{}{userID}},
+		{`DELETE FROM login_challenges WHERE user_id = ?`, []interface{}{userID}},
+	}
+	for _, q := range queries {
+		if _, err := tx.Exec(q.query, q.args...); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	S.DisconnectRevokedClients(userID)
+
+	ends := "until a moderator lifts it"
+	if !until.IsZero() {
+		ends = "until " + until.UTC().Format("2006-01-02 15:04 MST")
+	}
+	S.mailUser(userID, "Your account was suspended", fmt.Sprintf(
+		"Your account is suspended %s.\n\nReason: %s\n\nYou can appeal once by logging in at %s",
+		ends, html.UnescapeString(reason), AppURL))
+	return nil
+}
+
+// LiftSuspension ends userID's suspension
+func (S *Server) LiftSuspension(userID int) error {
+	_, err := S.db.Exec(`UPDATE users SET is_blocked = 0 WHERE id = ?`, userID)
+	return err
+}
+
+// GetSuspension returns userID's current suspension, or nil when they are not suspended
+func (S *Server) GetSuspension(userID int) (*Suspension, error) {
+	suspension, err := scanSuspension(S.db.QueryRow(suspensionSelectSQL+`
+		WHERE u.id = ? AND `+suspendedSQL("u.id"), userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &suspension, nil
+}
+
+// CheckNotSuspended answers a login attempt of a suspended user with the suspension and
+// its appeal, and returns false; it returns true when userID is not suspended
+func (S *Server) CheckNotSuspended(w http.ResponseWriter, userID int) bool {
+	suspension, err := S.GetSuspension(userID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if suspension == nil {
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      "account suspended",
+		"banned":     true,
+		"suspension": suspension,
+	})
+	return false
+}
+
+// mailUser mails userID if their address can be read
+func (S *Server) mailUser(userID int, subject, body string) {
+	var email string
+	if err := S.db.QueryRow(`SELECT email FROM users WHERE id = ?`, userID).Scan(&email); err != nil {
+		fmt.Println("Mail User Error : ", err)
+		return
+	}
+	S.SendMail(email, subject, body)
+}
+
+func scanSuspension(row interface{ Scan(...interface{}) error }) (Suspension, error) {
+	var suspension Suspension
+	var until, suspendedAt, appealCreatedAt, appealDecidedAt sql.NullTime
+	var suspendedBy, appealID sql.NullInt64
+	var appealMessage, appealStatus, appealResponse sql.NullString
+	err := row.Scan(&suspension.UserID, &suspension.Nickname, &suspension.Reason, &until, &suspendedAt, &suspendedBy,
+		&appealID, &appealMessage, &appealStatus, &appealResponse, &appealCreatedAt, &appealDecidedAt)
+	if err != nil {
+		return suspension, err
+	}
+	suspension.Until = formatNullTime(until)
+	suspension.SuspendedAt = formatNullTime(suspendedAt)
+	suspension.Automatic = !suspendedBy.Valid
+	if appealID.Valid {
+		suspension.Appeal = &Appeal{
+			ID:        int(appealID.Int64),
+			Message:   appealMessage.String,
+			Status:    appealStatus.String,
+			Response:  appealResponse.String,
+			CreatedAt: formatNullTime(appealCreatedAt),
+			DecidedAt: formatNullTime(appealDecidedAt),
+		}
+	}
+	return suspension, nil
+}
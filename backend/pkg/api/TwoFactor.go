@@ -0,0 +1,468 @@
+package backend
+
+import (
+	tools "SOCIAL-NETWORK/pkg"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTPIssuer names the service in authenticator apps
+const TOTPIssuer = "Social Network"
+
+// TOTP parameters (RFC 6238 defaults, which every authenticator app supports)
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// codes one step before or after the current one are accepted for clock drift
+	totpSkew = 1
+)
+
+// RecoveryCodeCount is how many recovery codes are issued when 2FA is enabled
+const RecoveryCodeCount = 10
+
+// LoginChallengeTTL is how long the code step of a two-factor login may take
+var LoginChallengeTTL = 5 * time.Minute
+
+// MaxLoginChallengeAttempts is how many wrong codes a login challenge takes before it is dropped
+const MaxLoginChallengeAttempts = 5
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorStatusHandler tells whether the current user has 2FA enabled and how many unused
+// recovery codes they have left
+func (S *Server) TwoFactorStatusHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodGet, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enabled, err := S.TwoFactorEnabled(currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	var left int
+	if err := S.db.QueryRow(`
+		SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL
+	`, currentUserID).Scan(&left); err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"enabled": enabled, "recoveryCodesLeft": left})
+}
+
+// SetupTwoFactorHandler starts enrolment: it generates a new secret and returns it with the
+// otpauth URI to show as a QR code. 2FA is only enabled once EnableTwoFactorHandler gets a code.
+func (S *Server) SetupTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enabled, err := S.TwoFactorEnabled(currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		tools.SendJSONError(w, "two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	var email string
+	if err := S.db.QueryRow(`SELECT email FROM users WHERE id = ?`, currentUserID).Scan(&email); err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	secret := totpEncoding.EncodeToString(raw)
+
+	if _, err := S.db.Exec(`
+		INSERT INTO two_factor (user_id, secret) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, last_step = 0, created_at = CURRENT_TIMESTAMP
+	`, currentUserID, secret); err != nil {
+		fmt.Println("Setup Two Factor Error : ", err)
+		tools.SendJSONError(w, "failed to start two-factor setup", http.StatusInternalServerError)
+		return
+	}
+
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {TOTPIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	// authenticator apps do not all read "+" as a space
+	uri := fmt.Sprintf("otpauth://totp/%s?%s",
+		url.PathEscape(TOTPIssuer+":"+email), strings.ReplaceAll(params.Encode(), "+", "%20"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"secret": secret, "uri": uri})
+}
+
+// EnableTwoFactorHandler confirms enrolment with a first code and returns the recovery codes.
+// They are only ever shown here.
+func (S *Server) EnableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	var enabled bool
+	err := S.db.QueryRow(`SELECT enabled FROM two_factor WHERE user_id = ?`, currentUserID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "start two-factor setup first", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		tools.SendJSONError(w, "two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	ok, err := S.CheckTOTP(currentUserID, body.Code)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		tools.SendJSONError(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	tx, err := S.db.Begin()
+	if err != nil {
+		tools.SendJSONError(w, "failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, currentUserID); err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	for i := range codes {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))
+		codes[i] = code[:8] + "-" + code[8:16]
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, currentUserID, hashToken(normalizeRecoveryCode(codes[i]))); err != nil {
+			fmt.Println("Enable Two Factor Error : ", err)
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if _, err := tx.Exec(`UPDATE two_factor SET enabled = 1, enabled_at = CURRENT_TIMESTAMP WHERE user_id = ?`, currentUserID); err != nil {
+		tools.SendJSONError(w, "failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		tools.SendJSONError(w, "failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"enabled": true, "recoveryCodes": codes})
+}
+
+// DisableTwoFactorHandler turns 2FA off. It takes a current code, a recovery code or the password.
+func (S *Server) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	banned, currentUserID := S.ActionMiddleware(r, http.MethodPost, true, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Code     string `json:"code"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	enabled, err := S.TwoFactorEnabled(currentUserID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !enabled {
+		tools.SendJSONError(w, "two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	if body.Password != "" {
+		if err := S.CheckCurrentPassword(r, currentUserID, body.Password); err != nil {
+			SendActionError(w, err)
+			return
+		}
+	} else {
+		// wrong codes count like failed logins, so a stolen session cannot guess its way through
+		accountKey, ipKey := loginThrottleKeys(r, currentUserID, "")
+		if err := S.CheckLoginLocked(accountKey, ipKey); err != nil {
+			SendActionError(w, err)
+			return
+		}
+		ok, err := S.CheckSecondFactor(currentUserID, body.Code)
+		if err != nil {
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			S.LoginFailed(r, currentUserID, accountKey, ipKey, SecurityTwoFactorFailed)
+			tools.SendJSONError(w, "invalid code", http.StatusForbidden)
+			return
+		}
+		S.ClearLoginFailures(accountKey)
+	}
+
+	tx, err := S.db.Begin()
+	if err != nil {
+		tools.SendJSONError(w, "failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		`DELETE FROM two_factor WHERE user_id = ?`,
+		`DELETE FROM recovery_codes WHERE user_id = ?`,
+		`DELETE FROM login_challenges WHERE user_id = ?`,
+	} {
+		if _, err := tx.Exec(query, currentUserID); err != nil {
+			tools.SendJSONError(w, "failed to disable two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tools.SendJSONError(w, "failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	S.LogSecurityEvent(r, currentUserID, SecurityTwoFactorDisabled, "")
+
+	var email string
+	if err := S.db.QueryRow(`SELECT email FROM users WHERE id = ?`, currentUserID).Scan(&email); err == nil {
+		S.SendMail(email, "Two-factor authentication was turned off",
+			"Two-factor authentication was just turned off for your account.\n\nIf it was not you, reset your password at "+AppURL+"/forgot-password and turn it back on")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"enabled": false})
+}
+
+// LoginTwoFactorHandler is the second step of a two-factor login: it trades the challenge from
+// LoginHandler and a code (or recovery code) for a session
+func (S *Server) LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	banned, _ := S.ActionMiddleware(r, http.MethodPost, false, false)
+	if banned {
+		tools.SendJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		tools.SendJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	challengeHash := hashToken(body.Challenge)
+	var userID int
+	var remember bool
+	err := S.db.QueryRow(`
+		SELECT user_id, remember FROM login_challenges
+		WHERE token_hash = ? AND expires_at > CURRENT_TIMESTAMP AND attempts < ?
+	`, challengeHash, MaxLoginChallengeAttempts).Scan(&userID, &remember)
+	if err == sql.ErrNoRows {
+		tools.SendJSONError(w, "login expired, enter your password again", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// wrong codes count against the account too, so new challenges do not give unlimited guesses
+	accountKey, ipKey := loginThrottleKeys(r, userID, "")
+	lockedUntil, err := S.LoginLockedUntil(accountKey, ipKey)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		SendLoginLocked(w, lockedUntil)
+		return
+	}
+
+	ok, err := S.CheckSecondFactor(userID, body.Code)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		S.db.Exec(`UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = ?`, challengeHash)
+		S.LoginFailed(r, userID, accountKey, ipKey, SecurityTwoFactorFailed)
+		tools.SendJSONError(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	// the challenge is single-use; deleting it also settles two requests racing with one code
+	res, err := S.db.Exec(`DELETE FROM login_challenges WHERE token_hash = ?`, challengeHash)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tools.SendJSONError(w, "login expired, enter your password again", http.StatusUnauthorized)
+		return
+	}
+
+	if !S.CheckNotSuspended(w, userID) {
+		return
+	}
+	if err := S.MakeToken(w, r, userID, remember); err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	S.ClearLoginFailures(accountKey)
+	userData, err := S.GetUserData("", userID)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user": userData,
+	})
+}
+
+// TwoFactorEnabled reports whether userID has confirmed 2FA enrolment
+func (S *Server) TwoFactorEnabled(userID int) (bool, error) {
+	var enabled bool
+	err := S.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM two_factor WHERE user_id = ? AND enabled = 1)`, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// IssueLoginChallenge records that userID passed the password step and returns the token
+// for the code step
+func (S *Server) IssueLoginChallenge(userID int, remember bool) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	// drop the user's stale challenges so the table does not grow
+	if _, err := S.db.Exec(`DELETE FROM login_challenges WHERE user_id = ? AND expires_at <= CURRENT_TIMESTAMP`, userID); err != nil {
+		return "", err
+	}
+	_, err = S.db.Exec(`
+		INSERT INTO login_challenges (token_hash, user_id, remember, expires_at) VALUES (?, ?, ?, ?)
+	`, hashToken(token), userID, remember, time.Now().Add(LoginChallengeTTL).UTC().Format("2006-01-02 15:04:05"))
+	return token, err
+}
+
+// CheckSecondFactor accepts a current TOTP code or an unused recovery code of userID,
+// which is then used up
+func (S *Server) CheckSecondFactor(userID int, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		return S.CheckTOTP(userID, code)
+	}
+
+	res, err := S.db.Exec(`
+		UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// CheckTOTP accepts a code for userID's secret within totpSkew steps of now. A code is accepted
+// once: its step must be later than the last one used.
+func (S *Server) CheckTOTP(userID int, code string) (bool, error) {
+	var secret string
+	var lastStep int64
+	err := S.db.QueryRow(`SELECT secret, last_step FROM two_factor WHERE user_id = ?`, userID).Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now().Unix() / totpPeriod
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		if step <= lastStep || !hmac.Equal([]byte(totpCode(key, step)), []byte(strings.TrimSpace(code))) {
+			continue
+		}
+		res, err := S.db.Exec(`UPDATE two_factor SET last_step = ? WHERE user_id = ? AND last_step < ?`, step, userID, step)
+		if err != nil {
+			return false, err
+		}
+		n, err := res.RowsAffected()
+		return n == 1, err
+	}
+	return false, nil
+}
+
+// totpCode is the RFC 6238 code of key for a time step, HMAC-SHA1 truncated as in RFC 4226
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
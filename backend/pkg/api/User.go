@@ -53,12 +53,18 @@ func (S *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := S.AddUser(user); err != nil {
+	userID, err := S.AddUser(user)
+	if err != nil {
 		fmt.Println("Error adding user to DB:", err)
 		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	// the account works right away, with limited permissions until the address is verified
+	if err := S.SendVerificationEmail(userID, refactorUserData(user).Email); err != nil {
+		fmt.Println("Error sending verification email:", err)
+	}
+
 	// Send success response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -84,25 +90,43 @@ func (S *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		tools.SendJSONError(w, "Email and password are required", http.StatusBadRequest)
 		return
 	}
-	url, hashedPassword, id, err := S.GetHashedPasswordFromDB(tools.ToLower(user.Identifier))
-	if err != nil {
-		fmt.Println("Error getting hashed password from DB:", err)
-		tools.SendJSONError(w, "Invalid email or password", http.StatusUnauthorized)
+	url, id, accountKey, ok := S.CheckLoginPassword(w, r, user.Identifier, user.Password)
+	if !ok {
+		return
+	}
+	// a suspended account learns why, and about its appeal, only with the right password
+	if !S.CheckNotSuspended(w, id) {
 		return
 	}
 
-	if err := tools.CheckPassword(hashedPassword, user.Password); err != nil {
-		fmt.Println("Password mismatch:", err)
-		tools.SendJSONError(w, "Invalid email or password", http.StatusUnauthorized)
+	// with 2FA the session is only made once LoginTwoFactorHandler gets a code
+	twoFactor, err := S.TwoFactorEnabled(id)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if twoFactor {
+		challenge, err := S.IssueLoginChallenge(id, user.Remember)
+		if err != nil {
+			fmt.Println("Error creating login challenge:", err)
+			tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"twoFactorRequired": true,
+			"challenge":         challenge,
+		})
 		return
 	}
 
-	err = S.MakeToken(w, id)
+	err = S.MakeToken(w, r, id, user.Remember)
 	if err != nil {
 		fmt.Println("Error creating session token:", err)
 		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	S.ClearLoginFailures(accountKey)
 
 	userData, err := S.GetUserData(url, id)
 	if err != nil {
@@ -117,6 +141,37 @@ func (S *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// CheckLoginPassword checks an identifier and password, counting failures towards the login
+// lockout. Unless ok, it has already answered the request.
+func (S *Server) CheckLoginPassword(w http.ResponseWriter, r *http.Request, identifier, password string) (url string, id int, accountKey string, ok bool) {
+	identifier = tools.ToLower(identifier)
+	url, hashedPassword, id, err := S.GetHashedPasswordFromDB(identifier)
+	if err != nil {
+		fmt.Println("Error getting hashed password from DB:", err)
+		// still compare a hash, so an unknown identifier takes as long as a wrong password
+		hashedPassword = string(dummyPasswordHash)
+	}
+
+	accountKey, ipKey := loginThrottleKeys(r, id, identifier)
+	lockedUntil, err := S.LoginLockedUntil(accountKey, ipKey)
+	if err != nil {
+		tools.SendJSONError(w, "Internal Server Error", http.StatusInternalServerError)
+		return "", 0, "", false
+	}
+	if !lockedUntil.IsZero() {
+		SendLoginLocked(w, lockedUntil)
+		return "", 0, "", false
+	}
+
+	if err := tools.CheckPassword(hashedPassword, password); err != nil || id == 0 {
+		fmt.Println("Password mismatch:", err)
+		S.LoginFailed(r, id, accountKey, ipKey, SecurityLoginFailed)
+		tools.SendJSONError(w, "Invalid email or password", http.StatusUnauthorized)
+		return "", 0, "", false
+	}
+	return url, id, accountKey, true
+}
+
 func (S *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	banned, _ := S.ActionMiddleware(r, http.MethodPost, true, false)
 	if banned {
@@ -131,6 +186,7 @@ func (S *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		tools.SendJSONError(w, "Error deleting session", http.StatusInternalServerError)
 		return
 	}
+	S.DisconnectRevokedClients(UserId)
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_token",
@@ -168,17 +224,18 @@ func (S *Server) MeHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(userData)
 }
 
-func (S *Server) AddUser(user User) error {
+// AddUser inserts a new, unverified account and returns its id
+func (S *Server) AddUser(user User) (int, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	user = refactorUserData(user)
 
 	query := `INSERT INTO users (first_name, last_name, birthdate, age, avatar, nickname, about_me,email,password,gender, url)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err = S.db.Exec(query,
+	res, err := S.db.Exec(query,
 		html.EscapeString(user.FirstName),
 		html.EscapeString(user.LastName),
 		html.EscapeString(user.DateOfBirth),
@@ -191,9 +248,10 @@ func (S *Server) AddUser(user User) error {
 		html.EscapeString(user.Gender),
 		html.EscapeString(user.Url))
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	id, err := res.LastInsertId()
+	return int(id), err
 }
 
 func (S *Server) GetHashedPasswordFromDB(identifier string) (string, string, int, error) {
@@ -218,7 +276,7 @@ func (S *Server) GetUserData(url string, id int) (UserData, error) {
 	var user UserData
 
 	err := S.db.QueryRow(`
-		SELECT id, first_name, last_name, nickname, email, birthdate, avatar, about_me, is_private, created_at, url, age
+		SELECT id, first_name, last_name, nickname, email, birthdate, avatar, about_me, is_private, created_at, url, age, email_verified
 		FROM users 
 		WHERE url = ? OR id = ?
 	`, url, id).Scan(
@@ -234,6 +292,7 @@ func (S *Server) GetUserData(url string, id int) (UserData, error) {
 		&user.JoinedDate,
 		&user.Url,
 		&user.Age,
+		&user.EmailVerified,
 	)
 	if err != nil {
 		return UserData{}, err
@@ -4,6 +4,7 @@ import (
 	tools "SOCIAL-NETWORK/pkg"
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/gorilla/websocket"
 	"github.com/twinj/uuid"
@@ -15,6 +16,28 @@ type Client struct {
 	Send      chan interface{} `json:"-"`
 	UserID    int              `json:"user_id"`
 	SessionID string           `json:"session_id"`
+	Topics    map[string]bool  `json:"-"` // guarded by the Server lock
+	Typing    map[string]bool  `json:"-"` // topics the user is typing in, guarded by the Server lock
+
+	done      chan struct{} // closed once the connection is going away
+	closeOnce sync.Once
+}
+
+// Push queues msg for the client's writer. Send is never closed, so pushing is safe from any
+// goroutine; once the connection is going away msg is dropped instead of blocking.
+func (c *Client) Push(msg interface{}) {
+	select {
+	case c.Send <- msg:
+	case <-c.done:
+	}
+}
+
+// Close closes the connection and stops the writer; it may be called more than once
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.Conn.Close()
+	})
 }
 
 func (S *Server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
@@ -38,6 +61,9 @@ func (S *Server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 		UserID:    userID,
 		SessionID: SessionID,
 		Send:      make(chan interface{}, 10),
+		done:      make(chan struct{}),
+		Topics:    make(map[string]bool),
+		Typing:    make(map[string]bool),
 	}
 
 	// add client
@@ -61,7 +87,7 @@ func (S *Server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 
 func (S *Server) StartReader(client *Client) {
 	defer func() {
-		client.Conn.Close()
+		client.Close()
 		S.Lock()
 		conns := S.Users[client.UserID]
 		for i, c := range conns {
@@ -70,63 +96,85 @@ func (S *Server) StartReader(client *Client) {
 				break
 			}
 		}
+		typing := client.Typing
+		client.Typing = map[string]bool{}
 		S.Unlock()
 
+		// a closed tab must not leave a typing indicator behind
+		for topic := range typing {
+			if kind, id, err := parseTopic(topic); err == nil {
+				S.PublishTopic(topic, "typing", typingPayload(kind, id, client.UserID, false), client.UserID)
+			}
+		}
+
 		if len(S.Users[client.UserID]) == 0 {
 			S.BroadcastOnlineStatus(client.UserID, "offline")
 		}
 	}()
 
 	for {
-		var msg map[string]interface{}
-		if err := client.Conn.ReadJSON(&msg); err != nil {
+		_, data, err := client.Conn.ReadMessage()
+		if err != nil {
 			return
 		}
-		// unified channel switch
-		switch msg["channel"] {
+		if !S.HandleSocketFrame(client, data) {
+			return
 		}
-
 	}
 }
 
 func (S *Server) StartWriter(c *Client) {
-	defer func() {
-		c.Conn.Close()
-		close(c.Send)
-	}()
+	defer c.Close()
 
-	for msg := range c.Send {
-		if err := c.Conn.WriteJSON(msg); err != nil {
-			fmt.Println("Error writing to client:", err)
+	for {
+		select {
+		case msg := <-c.Send:
+			if err := c.Conn.WriteJSON(msg); err != nil {
+				fmt.Println("Error writing to client:", err)
+				return
+			}
+		case <-c.done:
 			return
 		}
 	}
 }
 
+// PushNotification sends a notification event ("-new", "-read", ...) to every session of userID.
+// New notifications from a user whose notifications they muted are stored but not pushed.
 func (S *Server) PushNotification(notifType string, userID int, notif interface{}) {
+	if n, ok := notif.(Notification); ok && notifType == "-new" && n.ActorID != 0 && S.IsMuted(userID, n.ActorID, "notifications") {
+		return
+	}
+
 	S.RLock()
 	defer S.RUnlock()
 	for _, Session := range S.Users[userID] {
 		//fmt.Println("Sending notification to user", userID)
 		// fmt.Println("Notification:", notif)
-		Session.Send <- map[string]interface{}{
+		Session.Push(map[string]interface{}{
 			"channel": "notifications" + notifType,
 
 			"to":      userID,
 			"payload": notif,
-		}
+		})
 	}
 }
 
 func (S *Server) PushMessage(SessionID string, userID int, msg interface{}) {
+	S.PushMessageOn("chat", SessionID, userID, msg)
+}
+
+// PushMessageOn sends a chat event (new, edited or deleted message) to the sessions of userID
+// other than SessionID
+func (S *Server) PushMessageOn(channel, SessionID string, userID int, msg interface{}) {
 	S.RLock()
 	defer S.RUnlock()
 	for _, Session := range S.Users[userID] {
 		if Session.SessionID != SessionID {
-			Session.Send <- map[string]interface{}{
-				"channel": "chat",
+			Session.Push(map[string]interface{}{
+				"channel": channel,
 				"payload": msg,
-			}
+			})
 		}
 	}
 }
@@ -150,11 +198,11 @@ func (S *Server) BroadcastOnlineStatus(userID int, status string) {
 		}
 		chatID := S.GetChatID(userID, ID)
 		for _, Session := range S.Users[ID] {
-			Session.Send <- map[string]interface{}{
+			Session.Push(map[string]interface{}{
 				"channel": "status",
 				"user":    chatID,
 				"status":  status == "online",
-			}
+			})
 		}
 	}
 }
@@ -178,20 +226,132 @@ func (S *Server) PushNewChat(userID int, message map[string]interface{}) {
 	S.RLock()
 	defer S.RUnlock()
 	for _, Session := range S.Users[userID] {
-		Session.Send <- map[string]interface{}{
+		Session.Push(map[string]interface{}{
 			"channel": "new-chat",
 			"payload": message,
-		}
+		})
 	}
 }
 
-func (S *Server) PushNewPost(userID int, message map[string]interface{}) {
+// PushChatEvent sends a chat event such as a read receipt to every session of userID
+func (S *Server) PushChatEvent(channel string, userID int, payload interface{}) {
 	S.RLock()
 	defer S.RUnlock()
 	for _, Session := range S.Users[userID] {
-		Session.Send <- map[string]interface{}{
-			"channel": "new-post",
-			"payload": message,
+		Session.Push(map[string]interface{}{
+			"channel": channel,
+			"payload": payload,
+		})
+	}
+}
+
+// PushNewPost sends a new post to its author's sessions and to the connected followers
+// whose home feed shows it: those allowed to see it who have not muted the author's posts
+func (S *Server) PushNewPost(post Post) {
+	S.RLock()
+	var online []int
+	for userID, sessions := range S.Users {
+		if len(sessions) > 0 && userID != post.UserID {
+			online = append(online, userID)
+		}
+	}
+	S.RUnlock()
+
+	// these checks hit the database, so they run without holding the lock
+	recipients := []int{post.UserID}
+	for _, userID := range online {
+		if following, err := S.IsFollowing(userID, "", post.UserID); err != nil || !following {
+			continue
+		}
+		if ok, err := S.CheckPostPrivacy(post.ID, post.UserID, userID, post.Privacy); err != nil || !ok {
+			continue
+		}
+		if S.IsMuted(userID, post.UserID, "posts") {
+			continue
+		}
+		recipients = append(recipients, userID)
+	}
+
+	S.RLock()
+	defer S.RUnlock()
+	for _, userID := range recipients {
+		for _, Session := range S.Users[userID] {
+			Session.Push(map[string]interface{}{
+				"channel": "new-post",
+				"payload": map[string]interface{}{"post": post},
+			})
+		}
+	}
+}
+
+// PostViewers returns the connected users allowed to see postID
+func (S *Server) PostViewers(postID, authorID int) []int {
+	S.RLock()
+	var online []int
+	for userID, sessions := range S.Users {
+		if len(sessions) > 0 {
+			online = append(online, userID)
+		}
+	}
+	S.RUnlock()
+
+	// privacy checks hit the database, so they run without holding the lock
+	var allowed []int
+	for _, userID := range online {
+		if ok, err := S.CheckPostPrivacy(postID, authorID, userID, ""); err != nil || !ok {
+			continue
+		}
+		allowed = append(allowed, userID)
+	}
+	return allowed
+}
+
+// BroadcastPostDeleted tells viewers, the users who could see a post before it was deleted,
+// to drop it from their feeds
+func (S *Server) BroadcastPostDeleted(postID int, viewers []int) {
+	S.RLock()
+	defer S.RUnlock()
+	for _, userID := range viewers {
+		for _, Session := range S.Users[userID] {
+			Session.Push(map[string]interface{}{
+				"channel": "post-deleted",
+				"payload": map[string]interface{}{
+					"postId": postID,
+				},
+			})
+		}
+	}
+}
+
+// PushComment sends a comment event ("-new", "-edit" or "-delete") to every connected
+// user allowed to see the post who has not muted the comment's author.
+// Comment payloads get isOwn set for each recipient.
+func (S *Server) PushComment(event string, postID, authorID int, payload interface{}) {
+	var allowed []int
+	for _, userID := range S.PostViewers(postID, 0) {
+		if blocked, err := S.IsBlocked(authorID, userID); err != nil || blocked {
+			continue
+		}
+		if userID != authorID && S.IsMuted(userID, authorID, "comments") {
+			continue
+		}
+		allowed = append(allowed, userID)
+	}
+
+	S.RLock()
+	defer S.RUnlock()
+	for _, userID := range allowed {
+		msg := payload
+		if comment, ok := payload.(Comment); ok {
+			comment.IsOwn = userID == authorID
+			msg = comment
+		}
+		for _, Session := range S.Users[userID] {
+			Session.Push(map[string]interface{}{
+				"channel": "comments" + event,
+				"postId":  postID,
+				"payload": msg,
+			})
 		}
 	}
 }
@@ -0,0 +1,313 @@
+package backend
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WSProtocolVersion is the envelope version clients send in "v"
+const WSProtocolVersion = 1
+
+// MaxTopicsPerClient caps how many topics one connection can subscribe to
+const MaxTopicsPerClient = 50
+
+// HandleSocketFrame answers one client frame with an "ack" or "error" frame.
+// It returns false when the connection must be closed.
+func (S *Server) HandleSocketFrame(client *Client, data []byte) bool {
+	var req WSRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		S.sendSocketError(client, req, NewActionError(http.StatusBadRequest, "invalid frame"))
+		return true
+	}
+	if req.Version != WSProtocolVersion {
+		S.sendSocketError(client, req, NewActionError(http.StatusBadRequest, "unsupported protocol version"))
+		return true
+	}
+
+	// the session may have been logged out or expired since the socket was opened
+	userID, err := S.SessionUserID(client.SessionID)
+	if err != nil || userID != client.UserID {
+		client.Conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Unauthorized"),
+			time.Now().Add(time.Second))
+		return false
+	}
+
+	result, err := S.dispatchSocketRequest(client, req)
+	if err != nil {
+		S.sendSocketError(client, req, err)
+		return true
+	}
+
+	client.Push(map[string]interface{}{
+		"v":       WSProtocolVersion,
+		"channel": "ack",
+		"id":      req.ID,
+		"type":    req.Type,
+		"payload": result,
+	})
+	return true
+}
+
+func (S *Server) dispatchSocketRequest(client *Client, req WSRequest) (interface{}, error) {
+	switch req.Type {
+	case "ping":
+		return map[string]interface{}{}, nil
+
+	case "send-message":
+		var message Message
+		if err := decodeSocketPayload(req, &message); err != nil {
+			return nil, err
+		}
+		return S.SendDirectMessage(client.UserID, client.SessionID, message)
+
+	case "send-group-message":
+		var msg struct {
+			GroupID     int    `json:"groupId"`
+			Content     string `json:"content"`
+			MessageType string `json:"messageType"`
+		}
+		if err := decodeSocketPayload(req, &msg); err != nil {
+			return nil, err
+		}
+		return S.SendGroupMessage(client.UserID, client.SessionID, msg.GroupID, msg.MessageType, msg.Content)
+
+	case "read-notification":
+		var body struct {
+			ID int `json:"id"`
+		}
+		if err := decodeSocketPayload(req, &body); err != nil {
+			return nil, err
+		}
+		if err := S.MarkNotificationAsRead(body.ID, client.UserID); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"id": body.ID}, nil
+
+	case "read-all-notifications":
+		if err := S.MarkAllNotificationsAsRead(client.UserID); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{}, nil
+
+	case "read-chat":
+		var body struct {
+			ChatID int `json:"chatId"`
+		}
+		if err := decodeSocketPayload(req, &body); err != nil {
+			return nil, err
+		}
+		return S.MarkChatRead(client.UserID, body.ChatID)
+
+	case "read-group-chat":
+		var body struct {
+			GroupID int `json:"groupId"`
+		}
+		if err := decodeSocketPayload(req, &body); err != nil {
+			return nil, err
+		}
+		return S.MarkGroupChatRead(client.UserID, body.GroupID)
+
+	case "typing":
+		var body struct {
+			Topic  string `json:"topic"`
+			Typing bool   `json:"typing"`
+		}
+		if err := decodeSocketPayload(req, &body); err != nil {
+			return nil, err
+		}
+		if err := S.SetTyping(client, body.Topic, body.Typing); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"topic": body.Topic, "typing": body.Typing}, nil
+
+	case "subscribe", "unsubscribe":
+		var body struct {
+			Topic string `json:"topic"`
+		}
+		if err := decodeSocketPayload(req, &body); err != nil {
+			return nil, err
+		}
+		if req.Type == "unsubscribe" {
+			S.Lock()
+			delete(client.Topics, body.Topic)
+			S.Unlock()
+			return map[string]interface{}{"topic": body.Topic}, nil
+		}
+		if err := S.SubscribeTopic(client, body.Topic); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"topic": body.Topic}, nil
+	}
+
+	return nil, NewActionError(http.StatusBadRequest, "unknown request type")
+}
+
+func decodeSocketPayload(req WSRequest, v interface{}) error {
+	if len(req.Payload) == 0 || json.Unmarshal(req.Payload, v) != nil {
+		return NewActionError(http.StatusBadRequest, "invalid payload")
+	}
+	return nil
+}
+
+func (S *Server) sendSocketError(client *Client, req WSRequest, err error) {
+	actionErr, ok := err.(*ActionError)
+	if !ok {
+		fmt.Println("WebSocket request error:", err)
+		actionErr = NewActionError(http.StatusInternalServerError, "Internal Server Error")
+	}
+	client.Push(map[string]interface{}{
+		"v":       WSProtocolVersion,
+		"channel": "error",
+		"id":      req.ID,
+		"type":    req.Type,
+		"error": map[string]interface{}{
+			"status":  actionErr.Status,
+			"message": actionErr.Message,
+		},
+	})
+}
+
+// SubscribeTopic adds a topic to a connection once the user is allowed to follow it
+func (S *Server) SubscribeTopic(client *Client, topic string) error {
+	if err := S.CheckTopicAccess(client.UserID, topic); err != nil {
+		return err
+	}
+
+	S.Lock()
+	defer S.Unlock()
+	if !client.Topics[topic] && len(client.Topics) >= MaxTopicsPerClient {
+		return NewActionError(http.StatusBadRequest, "too many topics")
+	}
+	client.Topics[topic] = true
+	return nil
+}
+
+// DropTopic unsubscribes every connection of userID from topic, e.g. once they leave a chat
+func (S *Server) DropTopic(userID int, topic string) {
+	S.Lock()
+	defer S.Unlock()
+	for _, client := range S.Users[userID] {
+		delete(client.Topics, topic)
+		delete(client.Typing, topic)
+	}
+}
+
+// CheckTopicAccess returns an error unless userID may follow topic.
+// Topics are "post:{id}", "chat:{id}" and "group:{id}", with the same rules as the HTTP routes reading them.
+func (S *Server) CheckTopicAccess(userID int, topic string) error {
+	kind, id, err := parseTopic(topic)
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case "post":
+		allowed, err := S.CheckPostPrivacy(id, 0, userID, "")
+		if err == sql.ErrNoRows {
+			return NewActionError(http.StatusNotFound, "Post not found")
+		}
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return NewActionError(http.StatusUnauthorized, "Unauthorized to view this post")
+		}
+	case "chat":
+		if !S.CheckIfCaneSendMessage(userID, id) {
+			return NewActionError(http.StatusForbidden, "You are not a member of this chat")
+		}
+	case "group":
+		member, err := S.IsGroupMember(id, userID)
+		if err != nil {
+			return err
+		}
+		if !member {
+			return NewActionError(http.StatusForbidden, "Not a member")
+		}
+	}
+	return nil
+}
+
+func parseTopic(topic string) (string, int, error) {
+	kind, rawID, _ := strings.Cut(topic, ":")
+	id, err := strconv.Atoi(rawID)
+	if err != nil || id <= 0 || (kind != "post" && kind != "chat" && kind != "group") {
+		return "", 0, NewActionError(http.StatusBadRequest, "invalid topic")
+	}
+	return kind, id, nil
+}
+
+// SetTyping publishes a typing start or stop of client's user to the subscribers of a chat or group topic
+func (S *Server) SetTyping(client *Client, topic string, typing bool) error {
+	kind, id, err := parseTopic(topic)
+	if err != nil || kind == "post" {
+		return NewActionError(http.StatusBadRequest, "invalid topic")
+	}
+	if err := S.CheckTopicAccess(client.UserID, topic); err != nil {
+		return err
+	}
+
+	S.Lock()
+	if typing {
+		client.Typing[topic] = true
+	} else {
+		delete(client.Typing, topic)
+	}
+	S.Unlock()
+
+	S.PublishTopic(topic, "typing", typingPayload(kind, id, client.UserID, typing), client.UserID)
+	return nil
+}
+
+func typingPayload(kind string, id, userID int, typing bool) map[string]interface{} {
+	return map[string]interface{}{
+		kind + "Id": id,
+		"userId":    userID,
+		"typing":    typing,
+	}
+}
+
+// PublishTopic sends a message to every connection subscribed to topic, except those of
+// skipUserID (0 skips nobody). Access is checked again for each subscriber, since leaving a
+// group or a privacy change can take it away after subscribing; those connections are
+// unsubscribed instead.
+func (S *Server) PublishTopic(topic, channel string, payload interface{}, skipUserID int) {
+	S.RLock()
+	subscribers := map[int][]*Client{}
+	for userID, sessions := range S.Users {
+		if userID == skipUserID {
+			continue
+		}
+		for _, Session := range sessions {
+			if Session.Topics[topic] {
+				subscribers[userID] = append(subscribers[userID], Session)
+			}
+		}
+	}
+	S.RUnlock()
+
+	// access checks hit the database, so they run without holding the lock
+	for userID, sessions := range subscribers {
+		if err := S.CheckTopicAccess(userID, topic); err != nil {
+			if _, ok := err.(*ActionError); ok {
+				S.DropTopic(userID, topic)
+			}
+			continue
+		}
+		for _, Session := range sessions {
+			Session.Push(map[string]interface{}{
+				"channel": channel,
+				"topic":   topic,
+				"payload": payload,
+			})
+		}
+	}
+}
@@ -3,9 +3,14 @@ package backend
 import (
 	"SOCIAL-NETWORK/pkg/db/sqlite"
 	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/rs/cors"
@@ -17,6 +22,13 @@ type Server struct {
 	upgrader websocket.Upgrader
 	Users    map[int][]*Client
 	sync.RWMutex
+
+	// last result of the trending job
+	trending   Trending
+	trendingMu sync.RWMutex
+
+	// delivers verification and password reset emails, MailerFromEnv when nil at Run
+	Mailer Mailer
 }
 
 func (S *Server) Run(addr string) {
@@ -28,12 +40,40 @@ func (S *Server) Run(addr string) {
 		}
 	}(S.db)
 
+	MessageEditWindow = durationFromEnv("MESSAGE_EDIT_WINDOW", MessageEditWindow, 0)
+	TrendingWindow = durationFromEnv("TRENDING_WINDOW", TrendingWindow, time.Minute)
+	TrendingInterval = durationFromEnv("TRENDING_INTERVAL", TrendingInterval, time.Second)
+	EmailVerificationTTL = durationFromEnv("EMAIL_VERIFICATION_TTL", EmailVerificationTTL, time.Minute)
+	PasswordResetTTL = durationFromEnv("PASSWORD_RESET_TTL", PasswordResetTTL, time.Minute)
+	EmailChangeTTL = durationFromEnv("EMAIL_CHANGE_TTL", EmailChangeTTL, time.Minute)
+	SessionTTL = durationFromEnv("SESSION_TTL", SessionTTL, time.Minute)
+	RememberSessionTTL = durationFromEnv("REMEMBER_SESSION_TTL", RememberSessionTTL, time.Minute)
+	SessionSweepInterval = durationFromEnv("SESSION_SWEEP_INTERVAL", SessionSweepInterval, time.Second)
+	LoginChallengeTTL = durationFromEnv("LOGIN_CHALLENGE_TTL", LoginChallengeTTL, time.Minute)
+	LoginLockout = durationFromEnv("LOGIN_LOCKOUT", LoginLockout, time.Second)
+	LoginMaxLockout = durationFromEnv("LOGIN_MAX_LOCKOUT", LoginMaxLockout, LoginLockout)
+	LoginFailureWindow = durationFromEnv("LOGIN_FAILURE_WINDOW", LoginFailureWindow, time.Minute)
+	SecurityLogRetention = durationFromEnv("SECURITY_LOG_RETENTION", SecurityLogRetention, time.Hour)
+	StrikeLimit = intFromEnv("STRIKE_LIMIT", StrikeLimit, 0)
+	StrikeWindow = durationFromEnv("STRIKE_WINDOW", StrikeWindow, time.Minute)
+	StrikeSuspension = durationFromEnv("STRIKE_SUSPENSION", StrikeSuspension, time.Minute)
+	StrikeMaxSuspension = durationFromEnv("STRIKE_MAX_SUSPENSION", StrikeMaxSuspension, StrikeSuspension)
+	if appURL := os.Getenv("APP_URL"); appURL != "" {
+		AppURL = strings.TrimSuffix(appURL, "/")
+	}
+	if S.Mailer == nil {
+		S.Mailer = MailerFromEnv()
+	}
+
 	S.mux = http.NewServeMux()
 	S.initRoutes()
 	S.initWebSocket()
 
 	S.Users = make(map[int][]*Client)
 
+	go S.RunTrendingJob(TrendingInterval)
+	go S.RunSessionSweeper(SessionSweepInterval)
+
 	// CORS configuration
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"},
@@ -51,6 +91,36 @@ func (S *Server) Run(addr string) {
 	}
 }
 
+// durationFromEnv reads a duration such as "30m" from the environment variable name,
+// keeping current when it is unset, invalid or below min
+func durationFromEnv(name string, current, min time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return current
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < min {
+		fmt.Println("invalid", name, "keeping", current)
+		return current
+	}
+	return duration
+}
+
+// intFromEnv reads a whole number from the environment variable name, keeping current when
+// it is unset, invalid or below min
+func intFromEnv(name string, current, min int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return current
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min {
+		fmt.Println("invalid", name, "keeping", current)
+		return current
+	}
+	return n
+}
+
 func (S *Server) initRoutes() {
 	//file handlers
 	S.mux.HandleFunc("/api/file", S.AuthMiddleware(http.HandlerFunc(S.ProtectedFileHandler)))
@@ -70,55 +140,132 @@ func (S *Server) initRoutes() {
 	S.mux.HandleFunc("/ws", S.AuthMiddleware(http.HandlerFunc(S.WebSocketHandler)))
 	//auth handlers
 	S.mux.HandleFunc("/api/login", S.LoginHandler)
+	S.mux.HandleFunc("/api/login/2fa", S.LoginTwoFactorHandler)
 	S.mux.HandleFunc("/api/logged", S.LoggedHandler)
 	S.mux.HandleFunc("/api/logout", S.AuthMiddleware(http.HandlerFunc(S.LogoutHandler)))
+	S.mux.HandleFunc("/api/verify-email", S.VerifyEmailHandler)
+	S.mux.HandleFunc("/api/resend-verification", S.AuthMiddleware(http.HandlerFunc(S.ResendVerificationHandler)))
+	S.mux.HandleFunc("/api/forgot-password", S.ForgotPasswordHandler)
+	S.mux.HandleFunc("/api/reset-password", S.ResetPasswordHandler)
+	S.mux.HandleFunc("/api/change-password", S.AuthMiddleware(http.HandlerFunc(S.ChangePasswordHandler)))
+	S.mux.HandleFunc("/api/change-email", S.AuthMiddleware(http.HandlerFunc(S.ChangeEmailHandler)))
+	S.mux.HandleFunc("/api/confirm-email", S.ConfirmEmailChangeHandler)
+	S.mux.HandleFunc("/api/sessions", S.AuthMiddleware(http.HandlerFunc(S.GetSessionsHandler)))
+	S.mux.HandleFunc("/api/sessions/revoke", S.AuthMiddleware(http.HandlerFunc(S.RevokeSessionHandler)))
+	S.mux.HandleFunc("/api/sessions/revoke-others", S.AuthMiddleware(http.HandlerFunc(S.RevokeOtherSessionsHandler)))
+	S.mux.HandleFunc("/api/2fa", S.AuthMiddleware(http.HandlerFunc(S.TwoFactorStatusHandler)))
+	S.mux.HandleFunc("/api/2fa/setup", S.AuthMiddleware(http.HandlerFunc(S.SetupTwoFactorHandler)))
+	S.mux.HandleFunc("/api/2fa/enable", S.AuthMiddleware(http.HandlerFunc(S.EnableTwoFactorHandler)))
+	S.mux.HandleFunc("/api/2fa/disable", S.AuthMiddleware(http.HandlerFunc(S.DisableTwoFactorHandler)))
+	S.mux.HandleFunc("/api/security-log", S.AuthMiddleware(http.HandlerFunc(S.GetSecurityLogHandler)))
+	S.mux.HandleFunc("/api/suspension/appeal", S.AppealSuspensionHandler)
+	//moderation handlers
+	S.mux.HandleFunc("/api/moderation/suspensions", S.ModeratorMiddleware(http.HandlerFunc(S.GetSuspensionsHandler)))
+	S.mux.HandleFunc("/api/moderation/suspend", S.ModeratorMiddleware(http.HandlerFunc(S.SuspendUserHandler)))
+	S.mux.HandleFunc("/api/moderation/unsuspend", S.ModeratorMiddleware(http.HandlerFunc(S.UnsuspendUserHandler)))
+	S.mux.HandleFunc("/api/moderation/appeals/decide", S.ModeratorMiddleware(http.HandlerFunc(S.DecideAppealHandler)))
+	S.mux.HandleFunc("/api/moderation/security-log", S.ModeratorMiddleware(http.HandlerFunc(S.GetSecurityEventsHandler)))
 	//follow handlers
-	S.mux.HandleFunc("/api/follow", S.AuthMiddleware(http.HandlerFunc(S.FollowHandler)))
+	S.mux.HandleFunc("/api/follow", S.VerifiedMiddleware(http.HandlerFunc(S.FollowHandler)))
 	S.mux.HandleFunc("/api/unfollow", S.AuthMiddleware(http.HandlerFunc(S.UnfollowHandler)))
 	S.mux.HandleFunc("/api/cancel-follow-request", S.AuthMiddleware(http.HandlerFunc(S.CancelFollowRequestHandler)))
-	S.mux.HandleFunc("/api/accept-follow-request/", S.AuthMiddleware(http.HandlerFunc(S.AcceptFollowRequestHandler)))
+	S.mux.HandleFunc("/api/accept-follow-request/", S.VerifiedMiddleware(http.HandlerFunc(S.AcceptFollowRequestHandler)))
 	S.mux.HandleFunc("/api/decline-follow-request/", S.AuthMiddleware(http.HandlerFunc(S.DeclineFollowRequestHandler)))
-	S.mux.HandleFunc("/api/send-follow-request", S.AuthMiddleware(http.HandlerFunc(S.SendFollowRequestHandler)))
+	S.mux.HandleFunc("/api/send-follow-request", S.VerifiedMiddleware(http.HandlerFunc(S.SendFollowRequestHandler)))
 	S.mux.HandleFunc("/api/get-followers", S.AuthMiddleware(http.HandlerFunc(S.GetFollowersHandler)))
 	S.mux.HandleFunc("/api/get-followings", S.AuthMiddleware(http.HandlerFunc(S.GetFollowingsHandler)))
 
+	//block handlers
+	S.mux.HandleFunc("/api/block", S.AuthMiddleware(http.HandlerFunc(S.BlockUserHandler)))
+	S.mux.HandleFunc("/api/unblock", S.AuthMiddleware(http.HandlerFunc(S.UnblockUserHandler)))
+	S.mux.HandleFunc("/api/blocked-users", S.AuthMiddleware(http.HandlerFunc(S.GetBlockedUsersHandler)))
+
+	//mute handlers
+	S.mux.HandleFunc("/api/mute", S.AuthMiddleware(http.HandlerFunc(S.MuteUserHandler)))
+	S.mux.HandleFunc("/api/unmute", S.AuthMiddleware(http.HandlerFunc(S.UnmuteUserHandler)))
+	S.mux.HandleFunc("/api/muted-users", S.AuthMiddleware(http.HandlerFunc(S.GetMutedUsersHandler)))
+
+	//audience handlers
+	S.mux.HandleFunc("/api/audiences", S.AuthMiddleware(http.HandlerFunc(S.GetAudienceListsHandler)))
+	S.mux.HandleFunc("/api/audiences/create", S.AuthMiddleware(http.HandlerFunc(S.CreateAudienceListHandler)))
+	S.mux.HandleFunc("/api/audiences/update", S.AuthMiddleware(http.HandlerFunc(S.RenameAudienceListHandler)))
+	S.mux.HandleFunc("/api/audiences/delete/", S.AuthMiddleware(http.HandlerFunc(S.DeleteAudienceListHandler)))
+	S.mux.HandleFunc("/api/audiences/members/add", S.AuthMiddleware(http.HandlerFunc(S.AddAudienceMembersHandler)))
+	S.mux.HandleFunc("/api/audiences/members/remove", S.AuthMiddleware(http.HandlerFunc(S.RemoveAudienceMembersHandler)))
+
 	//profile handlers
 	S.mux.HandleFunc("/api/profile/", S.AuthMiddleware(http.HandlerFunc(S.ProfileHandler)))
 	S.mux.HandleFunc("/api/me", S.AuthMiddleware(http.HandlerFunc(S.MeHandler)))
 
 	//post handlers
-	S.mux.HandleFunc("/api/create-post", S.AuthMiddleware(http.HandlerFunc(S.CreatePostHandler)))
+	S.mux.HandleFunc("/api/create-post", S.VerifiedMiddleware(http.HandlerFunc(S.CreatePostHandler)))
 	S.mux.HandleFunc("/api/get-posts", S.AuthMiddleware(http.HandlerFunc(S.GetPostsHandler)))
+	S.mux.HandleFunc("/api/explore", S.AuthMiddleware(http.HandlerFunc(S.ExplorePostsHandler)))
+	S.mux.HandleFunc("/api/edit-post", S.VerifiedMiddleware(http.HandlerFunc(S.EditPostHandler)))
+	S.mux.HandleFunc("/api/delete-post/", S.AuthMiddleware(http.HandlerFunc(S.DeletePostHandler)))
+	S.mux.HandleFunc("/api/post-revisions/", S.AuthMiddleware(http.HandlerFunc(S.GetPostRevisionsHandler)))
+
+	//search handlers
+	S.mux.HandleFunc("/api/search", S.AuthMiddleware(http.HandlerFunc(S.SearchHandler)))
+
+	//hashtag handlers
+	S.mux.HandleFunc("/api/hashtags/", S.AuthMiddleware(http.HandlerFunc(S.HashtagFeedHandler)))
+	S.mux.HandleFunc("/api/trending", S.AuthMiddleware(http.HandlerFunc(S.TrendingHandler)))
+
+	//mention handlers
+	S.mux.HandleFunc("/api/mentions/suggest", S.AuthMiddleware(http.HandlerFunc(S.MentionSuggestHandler)))
+
+	//reaction handlers
+	S.mux.HandleFunc("/api/react-post", S.VerifiedMiddleware(http.HandlerFunc(S.ReactToPostHandler)))
+	S.mux.HandleFunc("/api/remove-reaction/", S.AuthMiddleware(http.HandlerFunc(S.RemoveReactionHandler)))
 
 	//comment handlers
-	S.mux.HandleFunc("/api/create-comment", S.AuthMiddleware(http.HandlerFunc(S.CreateCommentHandler)))
+	S.mux.HandleFunc("/api/create-comment", S.VerifiedMiddleware(http.HandlerFunc(S.CreateCommentHandler)))
 	S.mux.HandleFunc("/api/get-comments/", S.AuthMiddleware(http.HandlerFunc(S.GetCommentsHandler)))
-	// S.mux.HandleFunc("/api/delete-comment/", S.AuthMiddleware(http.HandlerFunc(S.DeleteCommentHandler)))
+	S.mux.HandleFunc("/api/edit-comment", S.VerifiedMiddleware(http.HandlerFunc(S.EditCommentHandler)))
+	S.mux.HandleFunc("/api/delete-comment/", S.AuthMiddleware(http.HandlerFunc(S.DeleteCommentHandler)))
+	S.mux.HandleFunc("/api/subscribe-comments/", S.AuthMiddleware(http.HandlerFunc(S.SubscribeCommentsHandler)))
+	S.mux.HandleFunc("/api/unsubscribe-comments/", S.AuthMiddleware(http.HandlerFunc(S.UnsubscribeCommentsHandler)))
 
 	//message handlers
 	S.mux.HandleFunc("/api/get-users", S.AuthMiddleware(http.HandlerFunc(S.GetUsersHandler)))
-	S.mux.HandleFunc("/api/make-chat/", S.AuthMiddleware(http.HandlerFunc(S.MakeChatHandler)))
-	S.mux.HandleFunc("/api/send-message/", S.AuthMiddleware(http.HandlerFunc(S.SendMessageHandler)))
+	S.mux.HandleFunc("/api/make-chat/", S.VerifiedMiddleware(http.HandlerFunc(S.MakeChatHandler)))
+	S.mux.HandleFunc("/api/send-message/", S.VerifiedMiddleware(http.HandlerFunc(S.SendMessageHandler)))
 	S.mux.HandleFunc("/api/get-messages/", S.AuthMiddleware(http.HandlerFunc(S.GetMessagesHandler)))
+	S.mux.HandleFunc("/api/edit-message", S.VerifiedMiddleware(http.HandlerFunc(S.EditMessageHandler)))
+	S.mux.HandleFunc("/api/unsend-message/", S.AuthMiddleware(http.HandlerFunc(S.UnsendMessageHandler)))
+	S.mux.HandleFunc("/api/delete-message/", S.AuthMiddleware(http.HandlerFunc(S.DeleteMessageForMeHandler)))
+	S.mux.HandleFunc("/api/mark-chat-read/", S.AuthMiddleware(http.HandlerFunc(S.MarkChatReadHandler)))
+	S.mux.HandleFunc("/api/unread-count", S.AuthMiddleware(http.HandlerFunc(S.UnreadCountHandler)))
+	S.mux.HandleFunc("/api/make-group-chat", S.VerifiedMiddleware(http.HandlerFunc(S.MakeGroupChatHandler)))
+	S.mux.HandleFunc("/api/chat-participants/", S.AuthMiddleware(http.HandlerFunc(S.GetChatParticipantsHandler)))
+	S.mux.HandleFunc("/api/add-chat-participant", S.VerifiedMiddleware(http.HandlerFunc(S.AddChatParticipantHandler)))
+	S.mux.HandleFunc("/api/remove-chat-participant", S.AuthMiddleware(http.HandlerFunc(S.RemoveChatParticipantHandler)))
+	S.mux.HandleFunc("/api/leave-chat/", S.AuthMiddleware(http.HandlerFunc(S.LeaveChatHandler)))
+	S.mux.HandleFunc("/api/rename-chat", S.VerifiedMiddleware(http.HandlerFunc(S.RenameChatHandler)))
 
 	// Group handlers
-	S.mux.HandleFunc("/api/groups/create", S.AuthMiddleware(http.HandlerFunc(S.CreateGroupHandler)))
+	S.mux.HandleFunc("/api/groups/create", S.VerifiedMiddleware(http.HandlerFunc(S.CreateGroupHandler)))
 	S.mux.HandleFunc("/api/groups", S.AuthMiddleware(http.HandlerFunc(S.GetGroupsHandler)))
 	S.mux.HandleFunc("/api/groups/", S.AuthMiddleware(http.HandlerFunc(S.GetGroupHandler)))
-	S.mux.HandleFunc("/api/groups/update", S.AuthMiddleware(http.HandlerFunc(S.UpdateGroupHandler)))
+	S.mux.HandleFunc("/api/groups/update", S.VerifiedMiddleware(http.HandlerFunc(S.UpdateGroupHandler)))
 	S.mux.HandleFunc("/api/groups/delete/", S.AuthMiddleware(http.HandlerFunc(S.DeleteGroupHandler)))
-	S.mux.HandleFunc("/api/groups/join", S.AuthMiddleware(http.HandlerFunc(S.JoinGroupRequestHandler)))
-	S.mux.HandleFunc("/api/groups/invite", S.AuthMiddleware(http.HandlerFunc(S.InviteGroupMemberHandler)))
-	S.mux.HandleFunc("/api/groups/requests/accept/", S.AuthMiddleware(http.HandlerFunc(S.AcceptGroupRequestHandler)))
+	S.mux.HandleFunc("/api/groups/join", S.VerifiedMiddleware(http.HandlerFunc(S.JoinGroupRequestHandler)))
+	S.mux.HandleFunc("/api/groups/invite", S.VerifiedMiddleware(http.HandlerFunc(S.InviteGroupMemberHandler)))
+	S.mux.HandleFunc("/api/groups/requests/accept/", S.VerifiedMiddleware(http.HandlerFunc(S.AcceptGroupRequestHandler)))
 	S.mux.HandleFunc("/api/groups/requests/decline/", S.AuthMiddleware(http.HandlerFunc(S.DeclineGroupRequestHandler)))
 	S.mux.HandleFunc("/api/groups/requests", S.AuthMiddleware(http.HandlerFunc(S.GetGroupRequestsHandler)))
-	S.mux.HandleFunc("/api/groups/posts/create", S.AuthMiddleware(http.HandlerFunc(S.CreateGroupPostHandler)))
+	S.mux.HandleFunc("/api/groups/posts/create", S.VerifiedMiddleware(http.HandlerFunc(S.CreateGroupPostHandler)))
 	S.mux.HandleFunc("/api/groups/posts/", S.AuthMiddleware(http.HandlerFunc(S.GetGroupPostsHandler)))
-	S.mux.HandleFunc("/api/groups/events/create", S.AuthMiddleware(http.HandlerFunc(S.CreateGroupEventHandler)))
+	S.mux.HandleFunc("/api/groups/events/create", S.VerifiedMiddleware(http.HandlerFunc(S.CreateGroupEventHandler)))
 	S.mux.HandleFunc("/api/groups/events/", S.AuthMiddleware(http.HandlerFunc(S.GetGroupEventsHandler)))
-	S.mux.HandleFunc("/api/groups/events/respond", S.AuthMiddleware(http.HandlerFunc(S.RespondToGroupEventHandler)))
+	S.mux.HandleFunc("/api/groups/events/respond", S.VerifiedMiddleware(http.HandlerFunc(S.RespondToGroupEventHandler)))
 	S.mux.HandleFunc("/api/groups/chat/", S.AuthMiddleware(http.HandlerFunc(S.GetGroupChatHandler)))
-	S.mux.HandleFunc("/api/groups/chat/send", S.AuthMiddleware(http.HandlerFunc(S.SendGroupMessageHandler)))
+	S.mux.HandleFunc("/api/groups/chat/send", S.VerifiedMiddleware(http.HandlerFunc(S.SendGroupMessageHandler)))
+	S.mux.HandleFunc("/api/groups/chat/edit", S.VerifiedMiddleware(http.HandlerFunc(S.EditGroupMessageHandler)))
+	S.mux.HandleFunc("/api/groups/chat/unsend/", S.AuthMiddleware(http.HandlerFunc(S.UnsendGroupMessageHandler)))
+	S.mux.HandleFunc("/api/groups/chat/delete/", S.AuthMiddleware(http.HandlerFunc(S.DeleteGroupMessageForMeHandler)))
+	S.mux.HandleFunc("/api/groups/chat/read/", S.AuthMiddleware(http.HandlerFunc(S.MarkGroupChatReadHandler)))
 	S.mux.HandleFunc("/api/groups/members/", S.AuthMiddleware(http.HandlerFunc(S.GetGroupMembersHandler)))
 }
 
@@ -0,0 +1,2 @@
+-- post (or other object) the notification points at, e.g. the reacted post
+ALTER TABLE notifications ADD COLUMN reference_id INTEGER;
@@ -0,0 +1,12 @@
+-- previous versions of a post, one row per edit
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    image TEXT,
+    privacy TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP, -- when this version was replaced
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+ALTER TABLE posts ADD COLUMN edited_at DATETIME;
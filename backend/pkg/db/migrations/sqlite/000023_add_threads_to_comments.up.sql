@@ -0,0 +1,5 @@
+ALTER TABLE comments ADD COLUMN parent_id INTEGER; -- parent comment for replies, NULL for top-level comments
+ALTER TABLE comments ADD COLUMN depth INTEGER NOT NULL DEFAULT 0; -- 0 for top-level comments
+ALTER TABLE comments ADD COLUMN edited_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments(parent_id);
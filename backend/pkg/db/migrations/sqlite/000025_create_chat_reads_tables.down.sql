@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS group_chat_reads;
+DROP TABLE IF EXISTS chat_reads;
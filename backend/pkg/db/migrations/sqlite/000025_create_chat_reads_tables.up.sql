@@ -0,0 +1,31 @@
+-- last message each user has read in a direct chat
+CREATE TABLE IF NOT EXISTS chat_reads (
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    last_read_id INTEGER NOT NULL DEFAULT 0, -- messages.backend_id
+    read_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(chat_id, user_id),
+    FOREIGN KEY(chat_id) REFERENCES chats(id) ON DELETE CASCADE,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- last message each member has read in a group chat
+CREATE TABLE IF NOT EXISTS group_chat_reads (
+    group_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    last_read_id INTEGER NOT NULL DEFAULT 0, -- group_messages.id
+    read_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(group_id, user_id),
+    FOREIGN KEY(group_id) REFERENCES groups(id) ON DELETE CASCADE,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- history from before read tracking counts as read
+INSERT OR IGNORE INTO chat_reads (chat_id, user_id, last_read_id)
+SELECT c.id, c.user1_id, COALESCE((SELECT MAX(m.backend_id) FROM messages m WHERE m.chat_id = c.id), 0) FROM chats c
+UNION ALL
+SELECT c.id, c.user2_id, COALESCE((SELECT MAX(m.backend_id) FROM messages m WHERE m.chat_id = c.id), 0) FROM chats c;
+
+INSERT OR IGNORE INTO group_chat_reads (group_id, user_id, last_read_id)
+SELECT gm.group_id, gm.user_id, COALESCE((SELECT MAX(m.id) FROM group_messages m WHERE m.group_id = gm.group_id), 0)
+FROM group_members gm;
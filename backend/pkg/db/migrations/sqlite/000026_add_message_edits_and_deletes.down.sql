@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS hidden_group_messages;
+DROP TABLE IF EXISTS hidden_messages;
+
+ALTER TABLE group_messages DROP COLUMN edited_at;
+ALTER TABLE group_messages DROP COLUMN is_deleted;
+
+ALTER TABLE messages DROP COLUMN edited_at;
@@ -0,0 +1,21 @@
+ALTER TABLE messages ADD COLUMN edited_at DATETIME;
+
+ALTER TABLE group_messages ADD COLUMN is_deleted BOOLEAN DEFAULT 0;
+ALTER TABLE group_messages ADD COLUMN edited_at DATETIME;
+
+-- messages a user deleted for themselves only
+CREATE TABLE IF NOT EXISTS hidden_messages (
+    message_id INTEGER NOT NULL, -- messages.backend_id
+    user_id INTEGER NOT NULL,
+    PRIMARY KEY(message_id, user_id),
+    FOREIGN KEY(message_id) REFERENCES messages(backend_id) ON DELETE CASCADE,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS hidden_group_messages (
+    message_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    PRIMARY KEY(message_id, user_id),
+    FOREIGN KEY(message_id) REFERENCES group_messages(id) ON DELETE CASCADE,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,23 @@
+DROP INDEX IF EXISTS idx_chat_participants_user_id;
+DROP TABLE IF EXISTS chat_participants;
+
+-- group DMs cannot be represented in the old table
+DELETE FROM hidden_messages WHERE message_id IN (
+    SELECT m.backend_id FROM messages m JOIN chats c ON c.id = m.chat_id WHERE c.is_group = 1);
+DELETE FROM messages WHERE chat_id IN (SELECT id FROM chats WHERE is_group = 1);
+DELETE FROM chat_reads WHERE chat_id IN (SELECT id FROM chats WHERE is_group = 1);
+
+CREATE TABLE chats_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user1_id INTEGER NOT NULL,
+    user2_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user1_id) REFERENCES users(id),
+    FOREIGN KEY(user2_id) REFERENCES users(id)
+);
+
+INSERT INTO chats_old (id, user1_id, user2_id, created_at)
+SELECT id, user1_id, user2_id, created_at FROM chats WHERE is_group = 0;
+
+DROP TABLE chats;
+ALTER TABLE chats_old RENAME TO chats;
@@ -0,0 +1,36 @@
+-- group DMs have no user1_id/user2_id, so the chats table is rebuilt with nullable columns
+CREATE TABLE chats_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user1_id INTEGER, -- one-to-one chats only
+    user2_id INTEGER, -- one-to-one chats only
+    title TEXT, -- group DMs only
+    is_group BOOLEAN NOT NULL DEFAULT 0,
+    created_by INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user1_id) REFERENCES users(id),
+    FOREIGN KEY(user2_id) REFERENCES users(id),
+    FOREIGN KEY(created_by) REFERENCES users(id)
+);
+
+INSERT INTO chats_new (id, user1_id, user2_id, created_by, created_at)
+SELECT id, user1_id, user2_id, user1_id, created_at FROM chats;
+
+DROP TABLE chats;
+ALTER TABLE chats_new RENAME TO chats;
+
+-- members of every chat, one-to-one chats included
+CREATE TABLE IF NOT EXISTS chat_participants (
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(chat_id, user_id),
+    FOREIGN KEY(chat_id) REFERENCES chats(id) ON DELETE CASCADE,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_participants_user_id ON chat_participants(user_id);
+
+INSERT OR IGNORE INTO chat_participants (chat_id, user_id, joined_at)
+SELECT id, user1_id, created_at FROM chats
+UNION ALL
+SELECT id, user2_id, created_at FROM chats;
@@ -0,0 +1,48 @@
+DROP INDEX IF EXISTS idx_message_attachments_group_message_id;
+DROP INDEX IF EXISTS idx_message_attachments_message_id;
+DROP TABLE IF EXISTS message_attachments;
+
+-- media messages cannot be represented with the old type CHECK
+DELETE FROM hidden_messages WHERE message_id IN (SELECT backend_id FROM messages WHERE type IN ('gif', 'image'));
+DELETE FROM messages WHERE type IN ('gif', 'image');
+DELETE FROM hidden_group_messages WHERE message_id IN (SELECT id FROM group_messages WHERE type IN ('gif', 'image'));
+DELETE FROM group_messages WHERE type IN ('gif', 'image');
+
+CREATE TABLE messages_old (
+    backend_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    id TEXT NOT NULL UNIQUE,
+    chat_id INTEGER NOT NULL,
+    sender_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    type TEXT CHECK(type IN ('text', 'emoji')),
+    is_deleted BOOLEAN DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    edited_at DATETIME,
+    FOREIGN KEY(chat_id) REFERENCES chats(id),
+    FOREIGN KEY(sender_id) REFERENCES users(id)
+);
+
+INSERT INTO messages_old (backend_id, id, chat_id, sender_id, content, type, is_deleted, created_at, edited_at)
+SELECT backend_id, id, chat_id, sender_id, content, type, is_deleted, created_at, edited_at FROM messages;
+
+DROP TABLE messages;
+ALTER TABLE messages_old RENAME TO messages;
+
+CREATE TABLE group_messages_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_id INTEGER NOT NULL,
+    sender_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    type TEXT CHECK(type IN ('text', 'emoji')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    is_deleted BOOLEAN DEFAULT 0,
+    edited_at DATETIME,
+    FOREIGN KEY(group_id) REFERENCES groups(id) ON DELETE CASCADE,
+    FOREIGN KEY(sender_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO group_messages_old (id, group_id, sender_id, content, type, created_at, is_deleted, edited_at)
+SELECT id, group_id, sender_id, content, type, created_at, is_deleted, edited_at FROM group_messages;
+
+DROP TABLE group_messages;
+ALTER TABLE group_messages_old RENAME TO group_messages;
@@ -0,0 +1,57 @@
+-- the type CHECK of both message tables only allowed text and emoji, so they are rebuilt
+CREATE TABLE messages_new (
+    backend_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    id TEXT NOT NULL UNIQUE,
+    chat_id INTEGER NOT NULL,
+    sender_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    type TEXT NOT NULL DEFAULT 'text' CHECK(type IN ('text', 'emoji', 'gif', 'image')),
+    is_deleted BOOLEAN DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    edited_at DATETIME,
+    FOREIGN KEY(chat_id) REFERENCES chats(id),
+    FOREIGN KEY(sender_id) REFERENCES users(id)
+);
+
+INSERT INTO messages_new (backend_id, id, chat_id, sender_id, content, type, is_deleted, created_at, edited_at)
+SELECT backend_id, id, chat_id, sender_id, content, COALESCE(type, 'text'), is_deleted, created_at, edited_at FROM messages;
+
+DROP TABLE messages;
+ALTER TABLE messages_new RENAME TO messages;
+
+CREATE TABLE group_messages_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_id INTEGER NOT NULL,
+    sender_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    type TEXT NOT NULL DEFAULT 'text' CHECK(type IN ('text', 'emoji', 'gif', 'image')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    is_deleted BOOLEAN DEFAULT 0,
+    edited_at DATETIME,
+    FOREIGN KEY(group_id) REFERENCES groups(id) ON DELETE CASCADE,
+    FOREIGN KEY(sender_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO group_messages_new (id, group_id, sender_id, content, type, created_at, is_deleted, edited_at)
+SELECT id, group_id, sender_id, content, COALESCE(type, 'text'), created_at, is_deleted, edited_at FROM group_messages;
+
+DROP TABLE group_messages;
+ALTER TABLE group_messages_new RENAME TO group_messages;
+
+-- files uploaded for messages. message_id/group_message_id stay NULL until the file is sent.
+CREATE TABLE IF NOT EXISTS message_attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    path TEXT NOT NULL UNIQUE, -- as returned by /api/upload-file, e.g. /uploads/Messages/{uuid}.jpg
+    uploader_id INTEGER NOT NULL,
+    mime_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    message_id INTEGER, -- messages.backend_id
+    group_message_id INTEGER, -- group_messages.id
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(uploader_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(message_id) REFERENCES messages(backend_id) ON DELETE CASCADE,
+    FOREIGN KEY(group_message_id) REFERENCES group_messages(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_attachments_message_id ON message_attachments(message_id);
+CREATE INDEX IF NOT EXISTS idx_message_attachments_group_message_id ON message_attachments(group_message_id);
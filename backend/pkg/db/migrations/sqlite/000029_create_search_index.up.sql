@@ -0,0 +1,85 @@
+-- full-text search indexes, kept in sync by triggers. FTS5 needs go-sqlite3 built with the
+-- sqlite_fts5 tag.
+-- Text is stored HTML-escaped (html.EscapeString), so the triggers index it unescaped: entities
+-- must not turn into search tokens ("amp", "39", ...) or be cut by a highlight. The tables keep
+-- their own copy of the text, which snippet() reads; the search handler escapes snippets again.
+CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+    content,
+    tokenize='unicode61 remove_diacritics 2', prefix='2 3'
+);
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO posts_fts(rowid, content) VALUES (new.id, replace(replace(replace(replace(replace(new.content, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'));
+END;
+CREATE TRIGGER IF NOT EXISTS posts_fts_delete AFTER DELETE ON posts BEGIN
+    DELETE FROM posts_fts WHERE rowid = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS posts_fts_update AFTER UPDATE OF content ON posts BEGIN
+    DELETE FROM posts_fts WHERE rowid = old.id;
+    INSERT INTO posts_fts(rowid, content) VALUES (new.id, replace(replace(replace(replace(replace(new.content, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'));
+END;
+
+INSERT INTO posts_fts(rowid, content)
+SELECT id, replace(replace(replace(replace(replace(content, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&') FROM posts;
+
+-- only text comments are indexed, image and gif comments hold a file path or link
+CREATE VIRTUAL TABLE IF NOT EXISTS comments_fts USING fts5(
+    content,
+    tokenize='unicode61 remove_diacritics 2', prefix='2 3'
+);
+
+CREATE TRIGGER IF NOT EXISTS comments_fts_insert AFTER INSERT ON comments
+WHEN COALESCE(new.type, 'text') IN ('text', 'emoji') BEGIN
+    INSERT INTO comments_fts(rowid, content) VALUES (new.id, replace(replace(replace(replace(replace(new.content, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'));
+END;
+CREATE TRIGGER IF NOT EXISTS comments_fts_delete AFTER DELETE ON comments BEGIN
+    DELETE FROM comments_fts WHERE rowid = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS comments_fts_update AFTER UPDATE OF content ON comments
+WHEN COALESCE(new.type, 'text') IN ('text', 'emoji') BEGIN
+    DELETE FROM comments_fts WHERE rowid = old.id;
+    INSERT INTO comments_fts(rowid, content) VALUES (new.id, replace(replace(replace(replace(replace(new.content, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'));
+END;
+
+INSERT INTO comments_fts(rowid, content)
+SELECT id, replace(replace(replace(replace(replace(content, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&') FROM comments WHERE COALESCE(type, 'text') IN ('text', 'emoji');
+
+CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+    first_name, last_name, nickname,
+    tokenize='unicode61 remove_diacritics 2', prefix='2 3'
+);
+
+CREATE TRIGGER IF NOT EXISTS users_fts_insert AFTER INSERT ON users BEGIN
+    INSERT INTO users_fts(rowid, first_name, last_name, nickname)
+    VALUES (new.id, replace(replace(replace(replace(replace(new.first_name, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'), replace(replace(replace(replace(replace(new.last_name, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'), replace(replace(replace(replace(replace(new.nickname, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'));
+END;
+CREATE TRIGGER IF NOT EXISTS users_fts_delete AFTER DELETE ON users BEGIN
+    DELETE FROM users_fts WHERE rowid = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS users_fts_update AFTER UPDATE OF first_name, last_name, nickname ON users BEGIN
+    DELETE FROM users_fts WHERE rowid = old.id;
+    INSERT INTO users_fts(rowid, first_name, last_name, nickname)
+    VALUES (new.id, replace(replace(replace(replace(replace(new.first_name, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'), replace(replace(replace(replace(replace(new.last_name, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'), replace(replace(replace(replace(replace(new.nickname, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'));
+END;
+
+INSERT INTO users_fts(rowid, first_name, last_name, nickname)
+SELECT id, replace(replace(replace(replace(replace(first_name, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'), replace(replace(replace(replace(replace(last_name, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'), replace(replace(replace(replace(replace(nickname, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&') FROM users;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS groups_fts USING fts5(
+    title, description,
+    tokenize='unicode61 remove_diacritics 2', prefix='2 3'
+);
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_insert AFTER INSERT ON groups BEGIN
+    INSERT INTO groups_fts(rowid, title, description) VALUES (new.id, replace(replace(replace(replace(replace(new.title, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'), replace(replace(replace(replace(replace(new.description, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'));
+END;
+CREATE TRIGGER IF NOT EXISTS groups_fts_delete AFTER DELETE ON groups BEGIN
+    DELETE FROM groups_fts WHERE rowid = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS groups_fts_update AFTER UPDATE OF title, description ON groups BEGIN
+    DELETE FROM groups_fts WHERE rowid = old.id;
+    INSERT INTO groups_fts(rowid, title, description) VALUES (new.id, replace(replace(replace(replace(replace(new.title, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'), replace(replace(replace(replace(replace(new.description, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'));
+END;
+
+INSERT INTO groups_fts(rowid, title, description)
+SELECT id, replace(replace(replace(replace(replace(title, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&'), replace(replace(replace(replace(replace(description, '&lt;', '<'), '&gt;', '>'), '&#34;', '"'), '&#39;', ''''), '&amp;', '&') FROM groups;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_comment_hashtags_post;
+DROP INDEX IF EXISTS idx_comment_hashtags_tag;
+DROP INDEX IF EXISTS idx_post_hashtags_tag;
+DROP TABLE IF EXISTS comment_hashtags;
+DROP TABLE IF EXISTS post_hashtags;
@@ -0,0 +1,23 @@
+-- hashtags used in a post's content, lowercased, one row per tag
+CREATE TABLE IF NOT EXISTS post_hashtags (
+    post_id INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP, -- when the tag was first used in the post
+    PRIMARY KEY (post_id, tag),
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+-- hashtags used in comments, post_id is kept to check the post's privacy
+CREATE TABLE IF NOT EXISTS comment_hashtags (
+    comment_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, tag),
+    FOREIGN KEY(comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_hashtags_tag ON post_hashtags(tag, created_at);
+CREATE INDEX IF NOT EXISTS idx_comment_hashtags_tag ON comment_hashtags(tag, created_at);
+CREATE INDEX IF NOT EXISTS idx_comment_hashtags_post ON comment_hashtags(post_id);
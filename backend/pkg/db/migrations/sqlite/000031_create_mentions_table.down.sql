@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_mentions_user;
+DROP TABLE IF EXISTS mentions;
@@ -0,0 +1,13 @@
+-- users mentioned with @handle in a post, comment or group message, who can see it
+CREATE TABLE IF NOT EXISTS mentions (
+    source TEXT NOT NULL CHECK(source IN ('post', 'comment', 'group_message')),
+    source_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,  -- mentioned user
+    actor_id INTEGER NOT NULL, -- author of the content
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (source, source_id, user_id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(actor_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_user ON mentions(user_id, created_at);
@@ -0,0 +1,15 @@
+-- user_id stops seeing muted_id's posts, comments, notifications or chat alerts, per column,
+-- until expires_at (NULL: until unmuted). Unlike a block, muted_id is not told and nothing is removed.
+CREATE TABLE IF NOT EXISTS mutes (
+    user_id INTEGER NOT NULL,
+    muted_id INTEGER NOT NULL,
+    posts BOOLEAN NOT NULL DEFAULT 0,
+    comments BOOLEAN NOT NULL DEFAULT 0,
+    notifications BOOLEAN NOT NULL DEFAULT 0,
+    chat BOOLEAN NOT NULL DEFAULT 0,
+    expires_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(user_id, muted_id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(muted_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_post_audiences_list;
+DROP INDEX IF EXISTS idx_audience_list_members_user;
+DROP TABLE IF EXISTS post_audiences;
+DROP TABLE IF EXISTS audience_list_members;
+DROP TABLE IF EXISTS audience_lists;
@@ -0,0 +1,30 @@
+-- named groups of followers (close friends, family...) a private post can be shared with
+CREATE TABLE IF NOT EXISTS audience_lists (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(owner_id, name),
+    FOREIGN KEY(owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS audience_list_members (
+    list_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(list_id, user_id),
+    FOREIGN KEY(list_id) REFERENCES audience_lists(id) ON DELETE CASCADE,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- the lists a private post is shared with, resolved when the post is read
+CREATE TABLE IF NOT EXISTS post_audiences (
+    post_id INTEGER NOT NULL,
+    list_id INTEGER NOT NULL,
+    PRIMARY KEY(post_id, list_id),
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY(list_id) REFERENCES audience_lists(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audience_list_members_user ON audience_list_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_post_audiences_list ON post_audiences(list_id);
@@ -0,0 +1,2 @@
+DELETE FROM email_tokens WHERE purpose = 'change_email';
+ALTER TABLE email_tokens DROP COLUMN new_email;
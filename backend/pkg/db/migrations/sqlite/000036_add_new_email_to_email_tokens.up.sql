@@ -0,0 +1,3 @@
+-- 'change_email' tokens carry the address the user asked to switch to; it is only applied once
+-- the link mailed there is followed
+ALTER TABLE email_tokens ADD COLUMN new_email TEXT;
@@ -0,0 +1,14 @@
+-- where and when each session was used, so users can see and revoke their devices.
+-- remember marks "remember me" sessions, whose expiry slides forward while they are used.
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN created_at DATETIME;
+ALTER TABLE sessions ADD COLUMN last_seen_at DATETIME;
+ALTER TABLE sessions ADD COLUMN remember BOOLEAN NOT NULL DEFAULT 0;
+
+-- expiries are compared with CURRENT_TIMESTAMP, so store them as UTC "YYYY-MM-DD HH:MM:SS"
+UPDATE sessions SET expires_at = COALESCE(datetime(expires_at), expires_at),
+    created_at = CURRENT_TIMESTAMP, last_seen_at = CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires ON sessions(expires_at);
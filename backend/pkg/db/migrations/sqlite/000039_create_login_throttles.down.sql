@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_security_events_user;
+DROP TABLE IF EXISTS security_events;
+DROP TABLE IF EXISTS login_throttles;
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_suspension_appeals_user;
+DROP TABLE IF EXISTS suspension_appeals;
+ALTER TABLE users DROP COLUMN is_moderator;
+ALTER TABLE users DROP COLUMN blocked_by;
+ALTER TABLE users DROP COLUMN blocked_at;
+ALTER TABLE users DROP COLUMN blocked_until;
+ALTER TABLE users DROP COLUMN blocked_reason;
+ALTER TABLE users DROP COLUMN is_blocked;
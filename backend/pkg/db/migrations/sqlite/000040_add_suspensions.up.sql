@@ -0,0 +1,29 @@
+-- account suspension. blocked_until NULL means until a moderator lifts it; blocked_by is the
+-- moderator, NULL when the suspension was automatic. blocked_at has milliseconds, since it
+-- also tells one suspension of a user from the next.
+ALTER TABLE users ADD COLUMN is_blocked BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN blocked_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN blocked_until DATETIME;
+ALTER TABLE users ADD COLUMN blocked_at DATETIME;
+ALTER TABLE users ADD COLUMN blocked_by INTEGER;
+
+-- moderators can suspend accounts and decide appeals. Granted directly in the database.
+ALTER TABLE users ADD COLUMN is_moderator BOOLEAN NOT NULL DEFAULT 0;
+
+-- a suspended user's request to have the suspension lifted, one per suspension: blocked_at
+-- is the users.blocked_at of the suspension appealed. status is 'pending', 'accepted' or 'rejected'.
+CREATE TABLE IF NOT EXISTS suspension_appeals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    blocked_at DATETIME NOT NULL,
+    message TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    response TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    decided_at DATETIME,
+    decided_by INTEGER,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(decided_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_suspension_appeals_user ON suspension_appeals(user_id, blocked_at);
@@ -0,0 +1,18 @@
+CREATE TABLE security_events_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    event TEXT NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO security_events_old (id, user_id, event, ip, user_agent, created_at)
+SELECT id, user_id, event, ip, user_agent, created_at FROM security_events
+WHERE user_id IS NOT NULL;
+
+DROP TABLE security_events;
+ALTER TABLE security_events_old RENAME TO security_events;
+
+CREATE INDEX IF NOT EXISTS idx_security_events_user ON security_events(user_id, created_at);
@@ -0,0 +1,23 @@
+-- strikes record the request that looked forged: endpoint is "METHOD /path", reason says what was wrong.
+-- Strikes from requests without a session have no user, so the table is rebuilt with a nullable
+-- user_id; those events are told apart by their ip
+CREATE TABLE security_events_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,
+    event TEXT NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    endpoint TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO security_events_new (id, user_id, event, ip, user_agent, created_at)
+SELECT id, user_id, event, ip, user_agent, created_at FROM security_events;
+
+DROP TABLE security_events;
+ALTER TABLE security_events_new RENAME TO security_events;
+
+CREATE INDEX IF NOT EXISTS idx_security_events_user ON security_events(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_event ON security_events(event, created_at);
@@ -39,6 +39,12 @@ func ConnectAndMigrate(dbPath string, migrationsDir string) *sql.DB {
 	}
 	log.Printf("Foreign keys enabled: %v", enabled == 1)
 
+	// Search relies on FTS5, which go-sqlite3 only compiles in with the sqlite_fts5 build tag
+	var fts5 int
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil || fts5 != 1 {
+		log.Fatalf("SQLite was built without FTS5, run the backend with: go run -tags sqlite_fts5 .")
+	}
+
 	// Get absolute path of migrations folder
 	absMigrations, err := filepath.Abs(migrationsDir)
 	if err != nil {
@@ -46,7 +46,7 @@ export function ExplorePage({ onNavigate, onNewPost }: ExplorePageProps) {
   useEffect(() => {
     const loadUsersFromPosts = async () => {
       try {
-        const res = await fetch(`${siteConfig.domain}/api/get-posts`, {
+        const res = await fetch(`${siteConfig.domain}/api/explore`, {
           credentials: "include",
         });
         if (!res.ok) throw new Error("Failed to fetch posts");
@@ -29,7 +29,7 @@ interface GroupChatMessage {
   authorName: string;
   authorAvatar: string;
   timestamp: string;
-  type: "text" | "emoji" | "image";
+  type: "text" | "emoji" | "gif" | "image";
   isOwn: boolean;
 }
 
@@ -63,14 +63,14 @@ export function GroupChat({
       if (res.ok) {
         const data = await res.json();
         // eslint-disable-next-line @typescript-eslint/no-explicit-any
-        const formattedMessages: GroupChatMessage[] = data?.map((msg: any) => ({
+        const formattedMessages: GroupChatMessage[] = (data?.messages ?? []).map((msg: any) => ({
           id: msg.id.toString(),
           content: msg.content,
           authorId: msg.senderId.toString(),
           authorName: msg.sender.firstName + " " + msg.sender.lastName,
           authorAvatar: msg.sender.avatar || "",
           timestamp: msg.createdAt,
-          type: "text",
+          type: msg.messageType || "text",
           isOwn: msg.isOwn,
         }));
         setMessages(formattedMessages);
@@ -100,7 +100,7 @@ export function GroupChat({
             authorName: data.sender.firstName + " " + data.sender.lastName,
             authorAvatar: data.sender.avatar || "",
             timestamp: data.createdAt,
-            type: "text", // Backend currently only supports text content in this payload structure
+            type: data.messageType || "text",
             isOwn: false, // We'll handle "isOwn" logic by checking senderId against current user if needed,
             // but for incoming WS messages, if it's broadcasted back to sender, we might duplicate.
             // Usually sender adds their own message optimistically or via API response.
@@ -143,7 +143,7 @@ export function GroupChat({
             authorName: data.sender.firstName + " " + data.sender.lastName,
             authorAvatar: data.sender.avatarUrl || "",
             timestamp: data.createdAt,
-            type: "text",
+            type: data.messageType || "text",
             isOwn: true,
           };
 
@@ -163,12 +163,61 @@ export function GroupChat({
     setShowEmojiPicker(false);
   };
 
-  const handleImageUpload = () => {
-    // Image upload logic would go here, likely needing a separate API endpoint
-    // For now, we'll just log it as not implemented fully in backend for chat yet
-    console.log("Image upload not yet implemented for group chat");
+  const handleImageUpload = async (
+    event: React.ChangeEvent<HTMLInputElement>
+  ) => {
+    const file = event.target.files?.[0];
+    if (!file) return;
+    event.target.value = "";
+
+    try {
+      const form = new FormData();
+      form.append("file", file);
+      form.append("type", "message");
+      const upload = await fetch(`${siteConfig.domain}/api/upload-file`, {
+        method: "POST",
+        body: form,
+        credentials: "include",
+      });
+      if (!upload.ok) throw new Error("Upload failed");
+      const { messageImageUrl } = await upload.json();
+
+      const res = await fetch(`${siteConfig.domain}/api/groups/chat/send`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({
+          groupId: parseInt(groupId),
+          content: messageImageUrl,
+          messageType: "image",
+        }),
+        credentials: "include",
+      });
+      if (!res.ok) throw new Error("Failed to send image");
+      const data = await res.json();
+      setMessages((prev) => [
+        ...(prev || []),
+        {
+          id: data.id.toString(),
+          content: data.content,
+          authorId: data.senderId.toString(),
+          authorName: data.sender.firstName + " " + data.sender.lastName,
+          authorAvatar: data.sender.avatarUrl || "",
+          timestamp: data.createdAt,
+          type: "image",
+          isOwn: true,
+        },
+      ]);
+    } catch (error) {
+      console.error("Failed to send image:", error);
+    }
   };
 
+  // uploaded message files are served by /api/file to the chat's members only
+  function showMessageImage(imagePath: string) {
+    if (!imagePath.startsWith("/uploads/")) return imagePath;
+    return `${siteConfig.domain}/api/file?filetype=message&path=${imagePath.slice(1)}`;
+  }
+
   const handleImageSelect = () => {
     fileInputRef.current?.click();
   };
@@ -260,14 +309,14 @@ export function GroupChat({
                     <div className="text-4xl cursor-pointer hover:scale-110 transition-transform">
                       {message.content}
                     </div>
-                  ) : message.type === "image" ? (
+                  ) : message.type === "image" || message.type === "gif" ? (
                     <div className="overflow-hidden max-w-xs cursor-pointer rounded-lg border border-border/20">
                       {/* eslint-disable-next-line @next/next/no-img-element */}
                       <img
-                        src={message.content}
+                        src={showMessageImage(message.content)}
                         alt="Uploaded image"
                         className="w-full h-auto hover:opacity-90 transition-opacity"
-                        onClick={() => window.open(message.content, "_blank")}
+                        onClick={() => window.open(showMessageImage(message.content), "_blank")}
                       />
                     </div>
                   ) : (
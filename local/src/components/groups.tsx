@@ -200,7 +200,7 @@ export function GroupsPage({ onNewPost, initialGroupId }: GroupsPageProps) {
       );
       if (res.ok) {
         const data = await res.json();
-        setGroupPosts(data || []);
+        setGroupPosts(data?.posts || []);
       }
     } catch (error) {
       console.error("Failed to fetch group posts:", error);
@@ -182,7 +182,7 @@ function HomeFeed({ onNewPost }: HomeFeedProps) {
           post.id === postId
             ? {
                 ...post,
-                commentsList: data || [],
+                commentsList: data?.comments || [],
               }
             : post
         )
@@ -355,7 +355,7 @@ export function MessagesPage({
         }
       );
       const messagesData = await response.json();
-      setMessages(messagesData);
+      setMessages(messagesData?.messages ?? []);
     } catch (error) {
       console.error("Error fetching messages:", error);
     } finally {
@@ -563,6 +563,12 @@ export function MessagesPage({
     }
   };
 
+  // uploaded message files are served by /api/file to the chat's members only
+  function showMessageImage(imagePath: string) {
+    if (!imagePath.startsWith("/uploads/")) return imagePath;
+    return `${siteConfig.domain}/api/file?filetype=message&path=${imagePath.slice(1)}`;
+  }
+
   const handleImageSelect = () => {
     fileInputRef.current?.click();
   };
@@ -651,37 +657,37 @@ export function MessagesPage({
     if (messageId === "") {
       return;
     }
-    // try {
-    //   const response = await fetch(
-    //     `${siteConfig.domain}/api/unsend-message/${messageId}`,
-    //     {
-    //       method: "POST",
-    //       credentials: "include",
-    //     }
-    //   );
-    //   if (!response.ok) throw new Error("Failed to unsend message");
-    //   setMessages((prev) => prev.filter((msg) => msg.id !== messageId));
-    //   const data = await response.json();
-    //   console.log("Unsent message:", data);
-    //   setChats((prevChats) =>
-    //     prevChats.map((c) => {
-    //       if (c.id == data.chat_id && c.lastMessageId == messageId) {
-    //         return {
-    //           ...c,
-    //           lastMessage: data.content,
-    //           lastMessageType: data.type,
-    //           lastMessageId: data.id,
-    //           timestamp: data.timestamp,
-    //           sender_id: data.sender_id,
-    //         };
-    //       } else {
-    //         return c;
-    //       }
-    //     })
-    //   );
-    // } catch (error) {
-    //   console.error("Error unsending message:", error);
-    // }
+    try {
+      const response = await fetch(
+        `${siteConfig.domain}/api/unsend-message/${messageId}`,
+        {
+          method: "POST",
+          credentials: "include",
+        }
+      );
+      if (!response.ok) throw new Error("Failed to unsend message");
+      setMessages((prev) => prev.filter((msg) => msg.id !== messageId));
+      const data = await response.json();
+      console.log("Unsent message:", data);
+      setChats((prevChats) =>
+        prevChats.map((c) => {
+          if (c.id == data.chat_id && c.lastMessageId == messageId) {
+            return {
+              ...c,
+              lastMessage: data.content,
+              lastMessageType: data.type,
+              lastMessageId: data.id,
+              timestamp: data.timestamp,
+              sender_id: data.sender_id,
+            };
+          } else {
+            return c;
+          }
+        })
+      );
+    } catch (error) {
+      console.error("Error unsending message:", error);
+    }
   };
 
   // eslint-disable-next-line @typescript-eslint/no-explicit-any
@@ -1059,7 +1065,7 @@ export function MessagesPage({
                                       <div className="rounded-xl overflow-hidden border border-border/50 shadow-md max-w-[280px]">
                                         {/* eslint-disable-next-line @next/next/no-img-element */}
                                         <img
-                                          src={message.content}
+                                          src={showMessageImage(message.content)}
                                           alt="GIF"
                                           className="w-full h-auto"
                                         />
@@ -1068,12 +1074,12 @@ export function MessagesPage({
                                       <div className="rounded-xl overflow-hidden border border-border/50 shadow-md max-w-[280px] group relative">
                                         {/* eslint-disable-next-line @next/next/no-img-element */}
                                         <img
-                                          src={`${siteConfig.domain}/${message.content}`}
+                                          src={showMessageImage(message.content)}
                                           alt="Shared image"
                                           className="w-full h-auto cursor-pointer transition-transform duration-500 group-hover:scale-105"
                                           onClick={() =>
                                             window.open(
-                                              message.content,
+                                              showMessageImage(message.content),
                                               "_blank"
                                             )
                                           }
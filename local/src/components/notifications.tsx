@@ -47,10 +47,9 @@ function NotificationsPage({ onNewPost }: NotificationsPageProps) {
             credentials: "include",
           });
           const data = await res.json();
-          // eslint-disable-next-line @typescript-eslint/no-explicit-any
-          const unread = data?.filter((n: any) => !n.isRead).length || 0;
+          const unread = data?.unreadCount || 0;
 
-          setNotifications(data || []);
+          setNotifications(data?.notifications || []);
           setCount(unread);
         } catch (err) {
           console.error("Failed to fetch initial notifications", err);
@@ -261,7 +261,7 @@ function UserProfile({
           post.id === postId
             ? {
                 ...post,
-                commentsList: data || [],
+                commentsList: data?.comments || [],
               }
             : post
         )
@@ -33,8 +33,7 @@ export const useNotificationCount = () => {
           credentials: "include",
         });
         const data = await res.json();
-        // eslint-disable-next-line @typescript-eslint/no-explicit-any
-        const unread = data?.filter((n: any) => !n.isRead).length || 0;
+        const unread = data?.unreadCount || 0;
         setCount(unread);
       } catch (err) {
         console.error("Failed to fetch initial notifications", err);
@@ -79,8 +78,8 @@ export const fetchNotifications = async (): Promise<Notification[]> => {
     const data = await response.json();
     console.log("Fetched notifications", data);
 
-    if (!data) return [];
-    return data;
+    if (!data?.notifications) return [];
+    return data.notifications;
   } catch (error) {
     console.error("Error fetching notifications:", error);
     return [];